@@ -3,6 +3,8 @@ package assert
 import (
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -97,3 +99,75 @@ func (gr *gitrepo) Branch(b string) {
 		gr.t.Fatalf("want %v, got %v\n", b, a)
 	}
 }
+
+// IsAncestor asserts the tip of ancestor is reachable from the tip of branch.
+func (gr *gitrepo) IsAncestor(ancestor, branch string) {
+	gr.t.Helper()
+	a := gr.commit(ancestor)
+	b := gr.commit(branch)
+
+	ok, err := a.IsAncestor(b)
+	if err != nil {
+		gr.t.Fatalf("call=IsAncestor err=`%v`\n", err)
+	}
+
+	if !ok {
+		gr.t.Fatalf("want %v ancestor of %v\n", ancestor, branch)
+	}
+}
+
+func (gr *gitrepo) commit(name string) *object.Commit {
+	gr.t.Helper()
+	ref, err := gr.g.Reference(plumbing.NewBranchReferenceName(name), true)
+	if err != nil {
+		gr.t.Fatalf("call=Reference branch=%v err=`%v`\n", name, err)
+	}
+
+	c, err := gr.g.CommitObject(ref.Hash())
+	if err != nil {
+		gr.t.Fatalf("call=CommitObject err=`%v`\n", err)
+	}
+	return c
+}
+
+// Parent asserts the first parent of branch is the tip of parent.
+func (gr *gitrepo) Parent(branch, parent string) {
+	gr.t.Helper()
+	c := gr.commit(branch)
+	p := gr.commit(parent)
+
+	if c.NumParents() == 0 || c.ParentHashes[0] != p.Hash {
+		gr.t.Fatalf("want %v parent of %v, got %v\n", parent, branch, c.ParentHashes)
+	}
+}
+
+// Message asserts the commit message of the tip of branch.
+func (gr *gitrepo) Message(branch, msg string) {
+	gr.t.Helper()
+	c := gr.commit(branch)
+	if c.Message != msg {
+		gr.t.Fatalf("want message %q, got %q\n", msg, c.Message)
+	}
+}
+
+// IncludesBranches asserts every branch exists locally.
+func (gr *gitrepo) IncludesBranches(branches ...string) {
+	gr.t.Helper()
+	for _, b := range branches {
+		_, err := gr.g.Reference(plumbing.NewBranchReferenceName(b), false)
+		if err != nil {
+			gr.t.Errorf("want branch %v, got err=`%v`\n", b, err)
+		}
+	}
+}
+
+// ExcludesBranches asserts no branch exists locally.
+func (gr *gitrepo) ExcludesBranches(branches ...string) {
+	gr.t.Helper()
+	for _, b := range branches {
+		_, err := gr.g.Reference(plumbing.NewBranchReferenceName(b), false)
+		if err == nil {
+			gr.t.Errorf("branches should not contain: %v\n", b)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// withAuth calls fn with the auth method for the remote. When an HTTP remote
+// rejects the request the credentials are requested from git credential fill
+// and fn is retried.
+func withAuth(repo *git.Repository, remote *git.Remote, fn func(transport.AuthMethod) error) error {
+	authcb, err := remoteAuth(repo, remote)
+	if err != nil {
+		return fmt.Errorf("call=remoteAuth err=`%w`", err)
+	}
+
+	err = fn(authcb)
+	u := remote.Config().URLs[0]
+	if !isHTTP(u) || !isAuthError(err) {
+		return err
+	}
+
+	cred, ok := credentialFill(u)
+	if !ok {
+		return err
+	}
+
+	return fn(cred)
+}
+
+func isAuthError(err error) bool {
+	return errors.Is(err, transport.ErrAuthenticationRequired) ||
+		errors.Is(err, transport.ErrAuthorizationFailed)
+}
+
+func isHTTP(u string) bool {
+	return strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")
+}
+
+// remoteAuth returns the auth method for the remote's URL.
+func remoteAuth(repo *git.Repository, remote *git.Remote) (transport.AuthMethod, error) {
+	u := remote.Config().URLs[0]
+	if isHTTP(u) {
+		return httpAuth(u)
+	}
+
+	if strings.HasPrefix(u, "file://") || filepath.IsAbs(u) {
+		return nil, nil
+	}
+
+	return sshAuth(repo, u)
+}
+
+// httpAuth returns basic auth from GIT_STACK_USERNAME and GIT_STACK_PASSWORD,
+// the URL's user info or a matching netrc entry in that order. A nil auth
+// method is returned when no credentials are found.
+func httpAuth(rawURL string) (transport.AuthMethod, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("call=Parse err=`%w`", err)
+	}
+
+	if password := os.Getenv("GIT_STACK_PASSWORD"); password != "" {
+		username := os.Getenv("GIT_STACK_USERNAME")
+		if username == "" && u.User != nil {
+			username = u.User.Username()
+		}
+		if username == "" {
+			username = "git"
+		}
+		return &http.BasicAuth{Username: username, Password: password}, nil
+	}
+
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			return &http.BasicAuth{Username: u.User.Username(), Password: password}, nil
+		}
+	}
+
+	username, password, ok := netrcLookup(netrcPath(), u.Hostname())
+	if ok {
+		return &http.BasicAuth{Username: username, Password: password}, nil
+	}
+
+	return nil, nil
+}
+
+// credentialFill asks the configured git credential helpers for the
+// credentials of the URL without prompting on the terminal.
+func credentialFill(rawURL string) (transport.AuthMethod, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, false
+	}
+
+	var in bytes.Buffer
+	fmt.Fprintf(&in, "protocol=%s\nhost=%s\n", u.Scheme, u.Host)
+	if u.User != nil {
+		fmt.Fprintf(&in, "username=%s\n", u.User.Username())
+	}
+	fmt.Fprintf(&in, "path=%s\n\n", strings.TrimPrefix(u.Path, "/"))
+
+	c := exec.Command("git", "credential", "fill")
+	c.Stdin = &in
+	c.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	b, err := c.Output()
+	if err != nil {
+		return nil, false
+	}
+
+	var auth http.BasicAuth
+	for _, line := range strings.Split(string(b), "\n") {
+		k, v, _ := strings.Cut(line, "=")
+		switch k {
+		case "username":
+			auth.Username = v
+		case "password":
+			auth.Password = v
+		}
+	}
+
+	if auth.Password == "" {
+		return nil, false
+	}
+	return &auth, true
+}
+
+// netrcPath returns $NETRC or the netrc file in the users home directory.
+func netrcPath() string {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc")
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// netrcLookup returns the login and password for host from the netrc file at
+// path falling back to the default entry.
+func netrcLookup(path, host string) (string, string, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", false
+	}
+	defer f.Close()
+
+	type entry struct{ login, password string }
+	var machines = map[string]*entry{}
+	var current *entry
+
+	sc := bufio.NewScanner(f)
+	sc.Split(bufio.ScanWords)
+	for sc.Scan() {
+		switch sc.Text() {
+		case "machine":
+			if !sc.Scan() {
+				break
+			}
+			current = &entry{}
+			machines[sc.Text()] = current
+		case "default":
+			current = &entry{}
+			machines[""] = current
+		case "login":
+			if sc.Scan() && current != nil {
+				current.login = sc.Text()
+			}
+		case "password":
+			if sc.Scan() && current != nil {
+				current.password = sc.Text()
+			}
+		}
+	}
+
+	for _, k := range []string{host, ""} {
+		if e, ok := machines[k]; ok && e.password != "" {
+			return e.login, e.password, true
+		}
+	}
+	return "", "", false
+}
@@ -26,6 +26,19 @@ func Test_branch_on_existing_stack_returns_success(t *testing.T) {
 	assert.Repo(t, repo).Branch("kb1234/004_ml_fairy")
 }
 
+func Test_branch_ignores_non_layer_branches_in_stack(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateBranch(t, repo, "kb1234", "x")
+	CheckoutBranch(t, WorkTree(t, repo), "kb1234/003_ui")
+
+	i := Exec(Flags{SubCommand: "branch", Name: "ml_fairy"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assert.Repo(t, repo).Branch("kb1234/004_ml_fairy")
+}
+
 func Test_branch_on_invalid_stack_fails(t *testing.T) {
 	repo, repoclose := CreateRepo(t)
 	defer repoclose()
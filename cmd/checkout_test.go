@@ -1,6 +1,7 @@
 package cmd_test
 
 import (
+	"bytes"
 	"github.com/nfisher/gitit/assert"
 	. "github.com/nfisher/gitit/cmd"
 	"io"
@@ -57,3 +58,130 @@ func Test_checkout_returns_missing_args_with_no_branch_id(t *testing.T) {
 	i := Exec(Flags{SubCommand: "checkout"}, io.Discard)
 	assert.Int(t, i).Equals(ErrMissingArguments)
 }
+
+func Test_checkout_matches_sequence_name_and_description(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+
+	td := map[string]string{
+		"2":        "kb1234/002_api",
+		"001":      "kb1234/001_docs",
+		"003_ui":   "kb1234/003_ui",
+		"api":      "kb1234/002_api",
+		"DOC":      "kb1234/001_docs",
+		"u":        "kb1234/003_ui",
+		"001_docs": "kb1234/001_docs",
+	}
+
+	for name, want := range td {
+		i := Exec(Flags{SubCommand: "checkout", Name: name}, io.Discard)
+		assert.Int(t, i).Equals(Success)
+		assert.Repo(t, repo).Branch(want)
+	}
+}
+
+func Test_checkout_without_match_fails(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+
+	i := Exec(Flags{SubCommand: "checkout", Name: "0"}, io.Discard)
+	assert.Int(t, i).Equals(ErrUnknownBranch)
+	assert.Repo(t, repo).Branch("kb1234/003_ui")
+}
+
+func Test_checkout_lists_candidates_when_ambiguous(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "checkout", Name: "i"}, &buf)
+	assert.Int(t, i).Equals(ErrAmbiguousBranch)
+	assert.String(t, buf.String()).Equals(`i is ambiguous, candidates are:
+  kb1234/002_api
+  kb1234/003_ui
+`)
+	assert.Repo(t, repo).Branch("kb1234/003_ui")
+}
+
+func Test_checkout_other_stack_from_anywhere(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CheckoutBranch(t, WorkTree(t, repo), "master")
+
+	td := []struct {
+		name string
+		want string
+	}{
+		{"kb1234", "kb1234/003_ui"},
+		{"kb1234/1", "kb1234/001_docs"},
+		{"kb3456", "kb3456/001_migration"},
+		{"kb1234/", "kb1234/003_ui"},
+		{"kb3456/migration", "kb3456/001_migration"},
+	}
+
+	for _, tc := range td {
+		var buf bytes.Buffer
+		i := Exec(Flags{SubCommand: "checkout", Name: tc.name}, &buf)
+		assert.Int(t, i).Equals(Success)
+		assert.String(t, buf.String()).Equals("Switched to branch " + tc.want + "\n")
+		assert.Repo(t, repo).Branch(tc.want)
+	}
+}
+
+func Test_checkout_unknown_stack_fails(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+
+	i := Exec(Flags{SubCommand: "checkout", Name: "kb9999/001"}, io.Discard)
+	assert.Int(t, i).Equals(ErrUnknownBranch)
+	assert.Repo(t, repo).Branch("kb1234/003_ui")
+}
+
+func Test_checkout_creates_stack_from_remote(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+	PushBranch(t, repo, "kb1234/001_docs")
+	PushBranch(t, repo, "kb1234/002_api")
+	CheckoutBranch(t, WorkTree(t, repo), "master")
+	DeleteBranch(t, repo, "kb1234/001_docs")
+	DeleteBranch(t, repo, "kb1234/002_api")
+	DeleteBranch(t, repo, "kb1234/003_ui")
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "checkout", Name: "kb1234/api", Fetch: true}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`Created kb1234/001_docs from origin
+Created kb1234/002_api from origin
+Switched to branch kb1234/002_api
+`)
+	assert.Repo(t, repo).Branch("kb1234/002_api")
+	assert.Exists(t, "api.js")
+}
+
+func Test_checkout_refuses_to_overwrite_local_changes(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateFile(t, "api.js", "function api() { return 1 }")
+
+	i := Exec(Flags{SubCommand: "checkout", Name: "001"}, io.Discard)
+	assert.Int(t, i).Equals(ErrUnknownBranch)
+	assert.Repo(t, repo).Branch("kb1234/003_ui")
+}
@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// Delete removes every layer branch of the named stack along with its
+// metadata and, when RemoteBranches is set, the stack's branches on the remote.
+// Layers whose work is neither on the trunk nor, for a local delete, on the
+// remote are only removed when Force is set.
+func Delete(input Flags, w io.Writer) int {
+	if input.Name == "" {
+		log.Printf("call=Name err=`stack name is empty, must be specified`\n")
+		return ErrMissingArguments
+	}
+
+	repo, wt, err := openWorkTree()
+	if err != nil {
+		log.Printf("call=openWorkTree err=`%v`\n", err)
+		return ErrNotRepository
+	}
+
+	stack := input.Name
+	layers, err := stackLayers(repo, stack)
+	if err != nil {
+		log.Printf("call=stackLayers err=`%v`\n", err)
+		return ErrInvalidStack
+	}
+
+	var remote *git.Remote
+	if input.RemoteBranches || input.Remote != "" {
+		remote, err = selectRemote(repo, input.Remote, stack)
+		if err != nil {
+			log.Printf("call=selectRemote err=`%v`\n", err)
+			return ErrInvalidArgument
+		}
+	}
+
+	trunk, err := stackTrunk(repo, stack)
+	if err != nil {
+		log.Printf("call=stackTrunk err=`%v`\n", err)
+		return ErrUnknownBranch
+	}
+
+	if !input.Force {
+		unmerged, err := unmergedLayers(repo, remote, trunk, stack, layers, input.RemoteBranches)
+		if err != nil {
+			log.Printf("call=unmergedLayers err=`%v`\n", err)
+			return ErrUnknownBranch
+		}
+		if len(unmerged) > 0 {
+			fmt.Fprintf(w, "Not deleting %s, unmerged layers: %s\nUse --force to delete them anyway.\n", stack, strings.Join(unmerged, ", "))
+			return ErrUnmergedStack
+		}
+	}
+
+	parts, err := headParts(repo)
+	if err == nil && isStack(parts) && parts[stackName] == stack {
+		_, err = gitCmd(wt, "checkout", trunk)
+		if err != nil {
+			log.Printf("call=gitCmd err=`%v`\n", err)
+			return ErrDeletingStack
+		}
+	}
+
+	if input.RemoteBranches {
+		err = deleteRemoteStack(repo, remote, stack, w)
+		if err != nil {
+			log.Printf("call=deleteRemoteStack err=`%v`\n", err)
+			return ErrDeletingStack
+		}
+	}
+
+	for _, l := range layers {
+		name := plumbing.NewBranchReferenceName(l)
+		ref, err := repo.Reference(name, true)
+		if err != nil {
+			log.Printf("call=Reference err=`%v`\n", err)
+			return ErrDeletingStack
+		}
+
+		err = repo.Storer.RemoveReference(name)
+		if err != nil {
+			log.Printf("call=RemoveReference err=`%v`\n", err)
+			return ErrDeletingStack
+		}
+		fmt.Fprintf(w, "Deleted branch %s (was %s)\n", l, ref.Hash().String()[:7])
+	}
+
+	err = removeStackMeta(repo, stack)
+	if err != nil {
+		log.Printf("call=removeStackMeta err=`%v`\n", err)
+		return ErrDeletingStack
+	}
+
+	return Success
+}
+
+// unmergedLayers returns the layers with commits that are not reachable from
+// trunk and have not been squash merged into it. Unless remoteToo is set a
+// layer is also safe when its remote-tracking ref contains it.
+func unmergedLayers(repo *git.Repository, remote *git.Remote, trunk, stack string, layers []string, remoteToo bool) ([]string, error) {
+	b, err := layerBranches(repo, layers)
+	if err != nil {
+		return nil, err
+	}
+
+	err = markMerged(repo, trunk, b)
+	if err != nil {
+		return nil, fmt.Errorf("call=markMerged err=`%w`", err)
+	}
+
+	trunkTip, err := branchCommit(repo, trunk)
+	if err != nil {
+		return nil, err
+	}
+
+	if remote == nil && !remoteToo {
+		remote, _ = selectRemote(repo, "", stack)
+	}
+	var pushed = map[string]plumbing.Hash{}
+	if remote != nil && !remoteToo {
+		name := remote.Config().Name
+		refs, err := trackingRefs(repo, name, stack)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range refs {
+			pushed[stack+"/"+strings.TrimPrefix(r.Name().String(), trackingPrefix(name, stack))] = r.Hash()
+		}
+	}
+
+	var unmerged []string
+	for i, l := range b {
+		if l.Merged || (i > 0 && l.hash == b[i-1].hash) {
+			continue
+		}
+
+		tip, err := repo.CommitObject(l.hash)
+		if err != nil {
+			return nil, fmt.Errorf("call=CommitObject err=`%w`", err)
+		}
+
+		if ok, err := tip.IsAncestor(trunkTip); err == nil && ok {
+			continue
+		}
+
+		if h, ok := pushed[l.Name]; ok {
+			if t := remoteState(repo, l.hash, h.String()); t.State == stateSame || t.State == stateBehind {
+				continue
+			}
+		}
+
+		unmerged = append(unmerged, l.Name)
+	}
+
+	return unmerged, nil
+}
+
+// deleteRemoteStack deletes every branch under refs/heads/<stack>/ on remote
+// and the matching remote-tracking refs.
+func deleteRemoteStack(repo *git.Repository, remote *git.Remote, stack string, w io.Writer) error {
+	var refs []*plumbing.Reference
+	err := withAuth(repo, remote, func(authcb transport.AuthMethod) error {
+		var err error
+		refs, err = remote.List(&git.ListOptions{Auth: authcb})
+		return err
+	})
+	if err != nil && err != transport.ErrEmptyRemoteRepository {
+		return fmt.Errorf("call=List err=`%w`", err)
+	}
+
+	var specs []config.RefSpec
+	prefix := "refs/heads/" + stack + "/"
+	for _, r := range refs {
+		if isLayerRef(r.Name().String(), prefix) {
+			specs = append(specs, config.RefSpec(":"+r.Name().String()))
+		}
+	}
+
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i] < specs[j]
+	})
+
+	name := remote.Config().Name
+	if len(specs) > 0 {
+		err = withAuth(repo, remote, func(authcb transport.AuthMethod) error {
+			return repo.Push(&git.PushOptions{
+				Auth:       authcb,
+				RemoteName: name,
+				RefSpecs:   specs,
+			})
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return fmt.Errorf("call=Push err=`%w`", err)
+		}
+	}
+
+	for _, s := range specs {
+		fmt.Fprintf(w, "Deleted %s on %s\n", s.Dst("").Short(), name)
+	}
+
+	tracking, err := trackingRefs(repo, name, stack)
+	if err != nil {
+		return err
+	}
+	for _, r := range tracking {
+		err = repo.Storer.RemoveReference(r.Name())
+		if err != nil {
+			return fmt.Errorf("call=RemoveReference err=`%w`", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package cmd_test
+
+import (
+	"bytes"
+	"github.com/nfisher/gitit/assert"
+	. "github.com/nfisher/gitit/cmd"
+	"io"
+	"testing"
+)
+
+func Test_delete_returns_missing_arguments_without_stack(t *testing.T) {
+	i := Exec(Flags{SubCommand: "delete"}, io.Discard)
+	assert.Int(t, i).Equals(ErrMissingArguments)
+}
+
+func Test_delete_unknown_stack_fails(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	CreateThreeLayerStack(t, repo)
+
+	i := Exec(Flags{SubCommand: "delete", Name: "kb9999"}, io.Discard)
+	assert.Int(t, i).Equals(ErrInvalidStack)
+}
+
+func Test_delete_ignores_non_stack_branches(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	CreateThreeLayerStack(t, repo)
+	CreateBranch(t, repo, "release", "v1")
+	CheckoutBranch(t, WorkTree(t, repo), "master")
+
+	i := Exec(Flags{SubCommand: "delete", Name: "release", Force: true}, io.Discard)
+	assert.Int(t, i).Equals(ErrInvalidStack)
+	assert.Repo(t, repo).IncludesBranches("release/v1")
+}
+
+func Test_delete_refuses_unmerged_stack(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	CreateThreeLayerStack(t, repo)
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "delete", Name: "kb1234"}, &buf)
+	assert.Int(t, i).Equals(ErrUnmergedStack)
+	assert.String(t, buf.String()).Equals(`Not deleting kb1234, unmerged layers: kb1234/001_docs, kb1234/002_api, kb1234/003_ui
+Use --force to delete them anyway.
+`)
+	assert.Repo(t, repo).Branch("kb1234/003_ui")
+	assert.Repo(t, repo).IncludesBranches("kb1234/001_docs", "kb1234/002_api", "kb1234/003_ui")
+}
+
+func Test_delete_forced_removes_every_layer(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	CreateThreeLayerStack(t, repo)
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "delete", Name: "kb1234", Force: true}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`Deleted branch kb1234/001_docs (was a4f8278)
+Deleted branch kb1234/002_api (was e8decd8)
+Deleted branch kb1234/003_ui (was cd73600)
+`)
+	assert.Repo(t, repo).Branch("master")
+	assert.Repo(t, repo).ExcludesBranches("kb1234/001_docs", "kb1234/002_api", "kb1234/003_ui")
+	assert.Repo(t, repo).IncludesBranches("kb3456/001_migration")
+}
+
+func Test_delete_merged_stack(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	CreateThreeLayerStack(t, repo)
+	CheckoutBranch(t, WorkTree(t, repo), "master")
+	out, err := GitCmd(t, "merge", "--ff-only", "kb1234/002_api")
+	if err != nil {
+		t.Fatalf("call=GitCmd err=`%v` output=`%s`", err, out)
+	}
+
+	i := Exec(Flags{SubCommand: "delete", Name: "kb1234"}, io.Discard)
+	assert.Int(t, i).Equals(ErrUnmergedStack)
+
+	out, err = GitCmd(t, "merge", "--ff-only", "kb1234/003_ui")
+	if err != nil {
+		t.Fatalf("call=GitCmd err=`%v` output=`%s`", err, out)
+	}
+
+	i = Exec(Flags{SubCommand: "delete", Name: "kb1234"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assert.Repo(t, repo).ExcludesBranches("kb1234/001_docs", "kb1234/002_api", "kb1234/003_ui")
+}
+
+func Test_delete_pushed_stack_keeps_remote(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+	t.Setenv("GITHUB_TOKEN", "")
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	i = Exec(Flags{SubCommand: "delete", Name: "kb1234"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assert.Repo(t, repo).ExcludesBranches("kb1234/001_docs", "kb1234/002_api", "kb1234/003_ui")
+	assert.Remote(t, server.Address()).IncludesBranches("kb1234/001_docs", "kb1234/002_api", "kb1234/003_ui")
+}
+
+func Test_delete_remote_branches(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+	PushBranch(t, repo, "master")
+	t.Setenv("GITHUB_TOKEN", "")
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	i = Exec(Flags{SubCommand: "delete", Name: "kb1234", RemoteBranches: true}, io.Discard)
+	assert.Int(t, i).Equals(ErrUnmergedStack)
+	assert.Remote(t, server.Address()).IncludesBranches("kb1234/001_docs", "kb1234/002_api", "kb1234/003_ui")
+
+	var buf bytes.Buffer
+	i = Exec(Flags{SubCommand: "delete", Name: "kb1234", RemoteBranches: true, Force: true}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`Deleted kb1234/001_docs on origin
+Deleted kb1234/002_api on origin
+Deleted kb1234/003_ui on origin
+Deleted branch kb1234/001_docs (was a4f8278)
+Deleted branch kb1234/002_api (was e8decd8)
+Deleted branch kb1234/003_ui (was cd73600)
+`)
+	assert.Remote(t, server.Address()).ExcludesBranches("kb1234/001_docs", "kb1234/002_api", "kb1234/003_ui")
+	assert.Remote(t, server.Address()).IncludesBranches("master")
+}
@@ -5,22 +5,29 @@ import (
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
-	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
-	"github.com/go-git/go-git/v5/storage/memory"
 	"io"
 	"log"
 	"os"
 	"runtime/debug"
 	"sort"
-	"strconv"
 	"strings"
 	"text/template"
 )
 
 type Flags struct {
-	SubCommand string
-	Name       string
+	SubCommand     string
+	Name           string
+	Fetch          bool
+	Remote         string
+	DryRun         bool
+	JSON           bool
+	Porcelain      bool
+	Base           string
+	RemoteBranches bool
+	Force          bool
+	To             int
 }
 
 const (
@@ -36,6 +43,15 @@ const (
 	ErrInvalidSequence
 	ErrCreatingBranch
 	ErrPushingStack
+	ErrRebasing
+	ErrSquashing
+	ErrPullingStack
+	ErrDiverged
+	ErrPullRequest
+	ErrStackExists
+	ErrUnmergedStack
+	ErrDeletingStack
+	ErrAmbiguousBranch
 )
 
 const (
@@ -51,19 +67,43 @@ func Exec(input Flags, w io.Writer) int {
 		return Branch(input)
 
 	case "checkout":
-		return Checkout(input)
+		return Checkout(input, w)
+
+	case "delete":
+		return Delete(input, w)
 
 	case "init":
 		return Init(input)
 
+	case "insert":
+		return Insert(input, w)
+
+	case "list":
+		return List(input, w)
+
+	case "move":
+		return Move(input, w)
+
+	case "next", "prev", "top", "bottom":
+		return Navigate(input, w)
+
+	case "pull":
+		return Pull(input, w)
+
 	case "push":
-		return Push(input)
+		return Push(input, w)
 
 	case "rebase":
-		return Rebase(input)
+		return Rebase(input, w)
+
+	case "remote":
+		return Remote(input, w)
+
+	case "rename":
+		return Rename(input, w)
 
 	case "squash":
-		return Squash(input)
+		return Squash(input, w)
 
 	case "status":
 		return Status(input, w)
@@ -120,30 +160,13 @@ func Branch(input Flags) int {
 		return ErrInvalidStack
 	}
 
-	var a []string
-	fn := func(reference *plumbing.Reference) error {
-		p := splitRef(reference)
-		if len(p) == 4 && p[stackName] == parts[stackName] {
-			a = append(a, p[stackBranch])
-		}
-		return nil
-	}
-
-	err = branchesApply(repo, fn)
+	layers, err := stackLayers(repo, parts[stackName])
 	if err != nil {
+		log.Printf("call=stackLayers err=`%v`\n", err)
 		return ErrUnknownBranch
 	}
 
-	sort.Strings(a)
-
-	last := a[len(a)-1][:3]
-	i, err := strconv.Atoi(last)
-	if err != nil {
-		log.Printf("call=Atoi err=`%v`\n", err)
-		return ErrInvalidSequence
-	}
-
-	name := fmt.Sprintf("%s/%03d_%s", parts[stackName], i+1, input.Name)
+	name := layerName(parts[stackName], layerSeq(layers[len(layers)-1])+1, input.Name)
 
 	err = wt.Checkout(&git.CheckoutOptions{
 		Branch: plumbing.NewBranchReferenceName(name),
@@ -173,8 +196,71 @@ func branchesApply(repo *git.Repository, fn func(reference *plumbing.Reference)
 	return nil
 }
 
+// stackLayers returns the short branch names of every layer in stack ordered
+// by sequence number.
+func stackLayers(repo *git.Repository, stack string) ([]string, error) {
+	var a []string
+	fn := func(reference *plumbing.Reference) error {
+		p := splitRef(reference)
+		if isStack(p) && p[stackName] == stack {
+			a = append(a, strings.Join(p[stackName:], "/"))
+		}
+		return nil
+	}
+
+	err := branchesApply(repo, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(a) == 0 {
+		return nil, fmt.Errorf("stack %s has no branches", stack)
+	}
+
+	sort.Strings(a)
+	return a, nil
+}
+
+// trunkName returns the first of main or master found in the local branches.
+func trunkName(repo *git.Repository) (string, error) {
+	for _, n := range []string{"main", "master"} {
+		_, err := repo.Reference(plumbing.NewBranchReferenceName(n), false)
+		if err == nil {
+			return n, nil
+		}
+	}
+	return "", fmt.Errorf("no trunk branch found, want main or master")
+}
+
+// isStack reports whether the parts of a branch ref name a stack layer, that
+// is refs/heads/<stack>/NNN_name. Other branches such as release/v1 are not
+// part of a stack.
 func isStack(parts []string) bool {
-	return len(parts) == 4
+	return len(parts) == 4 && isLayerName(parts[stackBranch])
+}
+
+// isLayerRef reports whether name is a layer directly below prefix such as
+// refs/remotes/origin/kb1234/001_docs for refs/remotes/origin/kb1234/.
+func isLayerRef(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	layer := strings.TrimPrefix(name, prefix)
+	return !strings.Contains(layer, "/") && isLayerName(layer)
+}
+
+// isLayerName reports whether name starts with a 3 digit sequence and an
+// underscore.
+func isLayerName(name string) bool {
+	if len(name) < 4 || name[3] != '_' {
+		return false
+	}
+	for _, c := range name[:3] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
 }
 
 func splitRef(reference *plumbing.Reference) []string {
@@ -183,35 +269,41 @@ func splitRef(reference *plumbing.Reference) []string {
 }
 
 func usage(w io.Writer) {
-	w.Write([]byte(`usage: git stack <command> [<name>]
+	w.Write([]byte(`usage: git stack <command> [<args>]
 
 These are common Stack commands used in various situations:
 
-start a new stack
+start and finish a stack
    init       Create a new stack
+   delete     Delete a stack locally and optionally on the remote
 
 examine the stack state
+   list       List every stack in the repository
    status     Show the stack status
 
 grow, mark and tweak your stack
    branch     Create a new stack branch
-   checkout   Switch branches within the stack using the index ID
+   insert     Create a new stack branch above the current one
+   move       Move a branch to another position in the stack
+   rename     Rename the stack and all of its branches
+   checkout   Switch branches using the index ID or name, or to another stack
+   next       Switch to the branch above the current one
+   prev       Switch to the branch below the current one
+   top        Switch to the last branch in the stack
+   bottom     Switch to the first branch in the stack
+   rebase     Restack every branch onto the trunk
+   squash     Squash each branch into a single commit
 
 collaborate
    pull       Fetch stack from and integrate with a local stack
    push       Update remote refs for stack along with associated objects
-`))
-}
-
-func Squash(_ Flags) int {
-	return Success
-}
+   remote     Show or set the default remote for the repository
 
-func Rebase(_ Flags) int {
-	return Success
+See 'git stack <command> --help' for the arguments of a command.
+`))
 }
 
-func Push(_ Flags) int {
+func Push(input Flags, w io.Writer) int {
 	repo, _, err := openWorkTree()
 	if err != nil {
 		log.Printf("call=openWorkTree err=`%v`\n", err)
@@ -228,46 +320,134 @@ func Push(_ Flags) int {
 		return ErrInvalidStack
 	}
 
-	remotes, err := repo.Remotes()
-	if err != nil {
-		log.Printf("call=Remotes err=`%v`\n", err)
+	remote, err := selectRemote(repo, input.Remote, parts[stackName])
+	if err == errNoRemote {
+		log.Printf("call=selectRemote err=`%v`\n", err)
 		return ErrInvalidStack
+	} else if err != nil {
+		log.Printf("call=selectRemote err=`%v`\n", err)
+		return ErrInvalidArgument
 	}
 
-	if len(remotes) < 1 {
-		log.Printf("call=Split err=`want 4 parts, got %d`\n", len(parts))
-		return ErrInvalidStack
+	stale, err := renameRemote(repo, remote, parts[stackName], input.DryRun, w)
+	if err != nil {
+		log.Printf("call=renameRemote err=`%v`\n", err)
+		return ErrPushingStack
 	}
 
-	var authcb transport.AuthMethod
-	u := remotes[0].Config().URLs[0]
-	if strings.HasPrefix(u, "http://") {
-
+	if input.DryRun {
+		err = pushPlan(repo, remote.Config().Name, parts[stackName], w)
+		if err != nil {
+			log.Printf("call=pushPlan err=`%v`\n", err)
+			return ErrPushingStack
+		}
 	} else {
-		authcb, err = ssh.NewSSHAgentAuth("git")
+		err = pushStack(repo, remote, parts[stackName], w)
 		if err != nil {
-			log.Printf("call=NewSSHAgentAuth err=`%v`\n", err)
-			return ErrInvalidStack
+			log.Printf("call=pushStack err=`%v`\n", err)
+			return ErrPushingStack
 		}
 	}
 
-	spec := config.RefSpec(fmt.Sprintf("refs/heads/%[1]s/*:refs/heads/%[1]s/*", parts[stackName]))
-	err = repo.Push(&git.PushOptions{
-		Auth:       authcb,
-		Progress:   os.Stdout,
-		RemoteName: "origin",
-		RefSpecs:   []config.RefSpec{spec},
-	})
+	err = pruneRenamed(repo, remote, parts[stackName], stale, input.DryRun, w)
 	if err != nil {
-		log.Printf("call=Push spec=%v err=`%v`\n", spec, err)
+		log.Printf("call=pruneRenamed err=`%v`\n", err)
 		return ErrPushingStack
 	}
-	// TODO: Open PR's.
+
+	err = syncPullRequests(repo, remote, parts[stackName], input.DryRun, w)
+	if err != nil {
+		log.Printf("call=syncPullRequests err=`%v`\n", err)
+		return ErrPullRequest
+	}
 
 	return Success
 }
 
-func Checkout(input Flags) int {
+// pushStack pushes every layer of stack to remote. Layers with a
+// remote-tracking ref are force pushed with a lease against it so a rebased,
+// squashed or moved layer replaces the remote one unless the remote has moved
+// since it was last fetched or pushed.
+func pushStack(repo *git.Repository, remote *git.Remote, stack string, w io.Writer) error {
+	layers, err := stackLayers(repo, stack)
+	if err != nil {
+		return fmt.Errorf("call=stackLayers err=`%w`", err)
+	}
+
+	name := remote.Config().Name
+	var created, leased []config.RefSpec
+	for _, l := range layers {
+		spec := config.RefSpec(fmt.Sprintf("refs/heads/%[1]s:refs/heads/%[1]s", l))
+		if _, err := repo.Reference(plumbing.NewRemoteReferenceName(name, l), true); err == nil {
+			leased = append(leased, spec)
+		} else {
+			created = append(created, spec)
+		}
+	}
+
+	for _, p := range []struct {
+		specs []config.RefSpec
+		lease *git.ForceWithLease
+	}{
+		{specs: created},
+		{specs: leased, lease: &git.ForceWithLease{}},
+	} {
+		if len(p.specs) == 0 {
+			continue
+		}
+
+		err = withAuth(repo, remote, func(authcb transport.AuthMethod) error {
+			return repo.Push(&git.PushOptions{
+				Auth:           authcb,
+				Progress:       w,
+				RemoteName:     name,
+				RefSpecs:       p.specs,
+				ForceWithLease: p.lease,
+			})
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return fmt.Errorf("call=Push specs=%v err=`%w`", p.specs, err)
+		}
+	}
+	return nil
+}
+
+// pushPlan writes the branches of stack that differ from their
+// remote-tracking refs without contacting the remote.
+func pushPlan(repo *git.Repository, remote, stack string, w io.Writer) error {
+	layers, err := stackLayers(repo, stack)
+	if err != nil {
+		return fmt.Errorf("call=stackLayers err=`%w`", err)
+	}
+
+	refs, err := trackingRefs(repo, remote, stack)
+	if err != nil {
+		return fmt.Errorf("call=trackingRefs err=`%w`", err)
+	}
+	var remoteShas = map[string]plumbing.Hash{}
+	for _, r := range refs {
+		remoteShas[stack+"/"+strings.TrimPrefix(r.Name().String(), trackingPrefix(remote, stack))] = r.Hash()
+	}
+
+	for _, l := range layers {
+		ref, err := repo.Reference(plumbing.NewBranchReferenceName(l), true)
+		if err != nil {
+			return fmt.Errorf("call=Reference branch=%s err=`%w`", l, err)
+		}
+		if h, ok := remoteShas[l]; ok && h == ref.Hash() {
+			continue
+		}
+		fmt.Fprintf(w, "Would push %s %s to %s\n", l, ref.Hash().String()[:7], remote)
+	}
+	return nil
+}
+
+// Checkout switches to a layer by sequence, full name or description, see
+// matchLayer. The layer is looked up in the current stack unless the input is
+// in the form <stack>[/<layer>] which works from any branch and defaults to
+// the top layer. A stack that only exists on the remote has its local
+// branches created from the remote-tracking refs.
+func Checkout(input Flags, w io.Writer) int {
 	if input.Name == "" {
 		log.Printf("call=Checkout err=`branch name empty`\n")
 		return ErrMissingArguments
@@ -282,36 +462,56 @@ func Checkout(input Flags) int {
 	if err != nil {
 		return ErrHead
 	}
-	if !isStack(parts) {
-		log.Printf("call=Split err=`want 4 parts, got %d`\n", len(parts))
-		return ErrInvalidStack
-	}
 
-	var target = ""
-	fn := func(reference *plumbing.Reference) error {
-		p := splitRef(reference)
-		if isCurrentStack(p, parts) && strings.HasPrefix(p[stackBranch], input.Name) {
-			target = strings.Join(p[stackName:], "/")
+	stack, query, explicit := strings.Cut(input.Name, "/")
+	if !explicit && isStack(parts) {
+		layers, err := stackLayers(repo, parts[stackName])
+		if err != nil {
+			log.Printf("call=stackLayers err=`%v`\n", err)
+			return ErrUnknownBranch
+		}
+
+		target, err := matchLayer(layers, input.Name)
+		if err == nil {
+			return switchLayer(wt, target, w)
+		} else if err != errNoLayer {
+			_, code := findLayer(layers, input.Name, w)
+			return code
 		}
-		return nil
 	}
 
-	err = branchesApply(repo, fn)
+	layers, err := stackLayers(repo, stack)
 	if err != nil {
-		return ErrOutputWriter
+		layers, err = trackStack(repo, input, stack, w)
 	}
-
-	if target == "" {
-		log.Printf("call=ForEach err=`%v not found`\n", input.Name)
+	if err != nil {
+		log.Printf("call=trackStack stack=%s err=`%v`\n", stack, err)
+		if !explicit && !isStack(parts) {
+			return ErrInvalidStack
+		}
 		return ErrUnknownBranch
 	}
 
-	err = wt.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(target), Keep: true})
+	target := layers[len(layers)-1]
+	if query != "" {
+		var code int
+		target, code = findLayer(layers, query, w)
+		if code != Success {
+			return code
+		}
+	}
+
+	return switchLayer(wt, target, w)
+}
+
+func switchLayer(wt *git.Worktree, layer string, w io.Writer) int {
+	err := checkoutLayer(wt, layer)
 	if err != nil {
-		log.Printf("call=Checkout err=`%v`\n", err)
+		log.Printf("call=checkoutLayer err=`%v`\n", err)
 		return ErrUnknownBranch
 	}
 
+	fmt.Fprintln(w, "Switched to branch", layer)
 	return Success
 }
 
@@ -320,25 +520,68 @@ func Init(input Flags) int {
 		return ErrMissingArguments
 	}
 
-	_, wt, err := openWorkTree()
+	repo, wt, err := openWorkTree()
 	if err != nil {
 		return ErrNotRepository
 	}
 
 	parts := strings.Split(input.Name, "/")
-	if len(parts) != 2 {
-		log.Printf("call=Split err=`%v`\n", err)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		log.Printf("call=Split err=`want <stack>/<name>, got %s`\n", input.Name)
 		return ErrInvalidArgument
 	}
 	name := fmt.Sprintf("%s/%03d_%s", parts[0], 1, parts[1])
+	if err := plumbing.NewBranchReferenceName(name).Validate(); err != nil {
+		log.Printf("call=Validate name=%s err=`%v`\n", name, err)
+		return ErrInvalidArgument
+	}
 
-	err = wt.Checkout(&git.CheckoutOptions{
-		Branch: plumbing.NewBranchReferenceName(name),
-		Create: true,
-		Keep:   true,
-	})
+	if _, err := stackLayers(repo, parts[0]); err == nil {
+		log.Printf("call=Init err=`stack %s already exists`\n", parts[0])
+		return ErrStackExists
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		log.Printf("call=Head err=`%v`\n", err)
+		return ErrHead
+	}
+
+	base := input.Base
+	start := head.Hash()
+	if base == "" {
+		base = head.Hash().String()
+		if head.Name().IsBranch() {
+			base = head.Name().Short()
+		}
+	} else {
+		h, err := repo.ResolveRevision(plumbing.Revision(base))
+		if err != nil {
+			log.Printf("call=ResolveRevision base=%s err=`%v`\n", base, err)
+			return ErrUnknownBranch
+		}
+		start = *h
+	}
+
+	if start == head.Hash() {
+		err = wt.Checkout(&git.CheckoutOptions{
+			Branch: plumbing.NewBranchReferenceName(name),
+			Create: true,
+			Keep:   true,
+		})
+	} else {
+		// the git binary carries local changes across or refuses when they
+		// would be overwritten.
+		_, err = gitCmd(wt, "checkout", "-b", name, start.String())
+	}
 	if err != nil {
 		log.Printf("call=Checkout err=`%v`\n", err)
+		return ErrCreatingBranch
+	}
+
+	err = writeStackMeta(repo, parts[0], newStackMeta(repo, base))
+	if err != nil {
+		log.Printf("call=writeStackMeta err=`%v`\n", err)
 		return ErrNotRepository
 	}
 	return Success
@@ -349,9 +592,29 @@ type Stack struct {
 	Branches branches
 	Name     string
 	Remote   string
+	// Base and Trunk are empty unless recorded by init.
+	Base  string
+	Trunk string
 }
 
-func Status(_ Flags, w io.Writer) int {
+// Width returns the length of the longest branch name for alignment.
+func (s *Stack) Width() int {
+	var n int
+	for _, b := range s.Branches {
+		n = max(n, len(b.Name))
+	}
+	return n
+}
+
+// Status reports the state of the current stack. Remote state is taken from
+// the remote-tracking refs unless Fetch is set in which case they're
+// refreshed from the network first along with any pull requests.
+func Status(input Flags, w io.Writer) int {
+	if input.JSON && input.Porcelain {
+		log.Printf("call=Status err=`--json and --porcelain are mutually exclusive`\n")
+		return ErrInvalidArgument
+	}
+
 	repo, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
 	if err == git.ErrRepositoryNotExists {
 		log.Printf("call=PlainOpen err=`%v`\n", err)
@@ -364,27 +627,31 @@ func Status(_ Flags, w io.Writer) int {
 	}
 
 	if isStack(parts) {
-		var defaultRemote *config.RemoteConfig
-		remotes, err := repo.Remotes()
-		if err != nil {
-			log.Printf("call=Remotes err=`%v`\n", err)
-			return ErrOutputWriter
+		defaultRemote, err := selectRemote(repo, input.Remote, parts[stackName])
+		if err != nil && err != errNoRemote {
+			log.Printf("call=selectRemote err=`%v`\n", err)
+			return ErrInvalidArgument
 		}
 		var remoteShas = map[string]string{}
-		if len(remotes) > 0 {
-			defaultRemote = remotes[0].Config()
-			remote := git.NewRemote(memory.NewStorage(), defaultRemote)
-			refs, err := remote.List(&git.ListOptions{})
+		if defaultRemote != nil {
+			if input.Fetch {
+				err = fetchStack(repo, defaultRemote, parts[stackName])
+				if err != nil {
+					log.Printf("call=fetchStack err=`%v`\n", err)
+					return ErrOutputWriter
+				}
+			}
+
+			name := defaultRemote.Config().Name
+			refs, err := trackingRefs(repo, name, parts[stackName])
 			if err != nil {
-				log.Printf("call=List err=`%v`\n", err)
+				log.Printf("call=trackingRefs err=`%v`\n", err)
 				return ErrOutputWriter
 			}
-			var prefix = strings.Join(parts[:3], "/")
+			prefix := trackingPrefix(name, parts[stackName])
 			for _, r := range refs {
-				s := r.Name().String()
-				if strings.HasPrefix(s, prefix) {
-					remoteShas[s] = r.Hash().String()
-				}
+				s := "refs/heads/" + parts[stackName] + "/" + strings.TrimPrefix(r.Name().String(), prefix)
+				remoteShas[s] = r.Hash().String()
 			}
 		}
 
@@ -393,24 +660,22 @@ func Status(_ Flags, w io.Writer) int {
 			p := splitRef(reference)
 			s := reference.Name().String()
 			if isCurrentStack(p, parts) {
-				var status = ""
-				if len(remoteShas) > 0 {
-					sha, ok := remoteShas[s]
-					if !ok {
-						status = "+"
-					} else if sha == reference.Hash().String() {
-						status = "="
-					} else {
-						// TODO: change to walk branch for now test for presence in local repo.
-						_, err := repo.CommitObject(plumbing.NewHash(sha))
-						if err != nil {
-							status = "∇"
-						} else {
-							status = "+"
-						}
-					}
+				var t tracking
+				if defaultRemote != nil {
+					t = remoteState(repo, reference.Hash(), remoteShas[s])
 				}
-				b = append(b, branch{Name: p[3], Status: status})
+				c, err := repo.CommitObject(reference.Hash())
+				if err != nil {
+					return err
+				}
+				b = append(b, branch{
+					Name:     p[3],
+					SHA:      reference.Hash().String()[:7],
+					Subject:  strings.SplitN(strings.TrimSpace(c.Message), "\n", 2)[0],
+					Current:  p[3] == parts[stackBranch],
+					tracking: t,
+					hash:     reference.Hash(),
+				})
 			}
 			return nil
 		}
@@ -422,26 +687,42 @@ func Status(_ Flags, w io.Writer) int {
 
 		sort.Sort(b)
 
+		if defaultRemote != nil && input.Fetch {
+			err = annotatePullRequests(repo, defaultRemote, parts[stackName], b)
+			if err != nil {
+				log.Printf("call=annotatePullRequests err=`%v`\n", err)
+			}
+		}
+
+		if trunk, err := stackTrunk(repo, parts[stackName]); err == nil {
+			err = markMerged(repo, trunk, b)
+			if err != nil {
+				log.Printf("call=markMerged err=`%v`\n", err)
+			}
+		}
+
+		meta := readStackMeta(repo, parts[stackName])
 		stack := &Stack{
 			Name:     parts[2],
 			Branch:   parts[3],
 			Branches: b,
+			Base:     meta.Base,
+			Trunk:    meta.Trunk,
 		}
 		if defaultRemote != nil {
-			stack.Remote = defaultRemote.Name
+			stack.Remote = defaultRemote.Config().Name
 		}
-		err = stackTpl.Execute(w, stack)
+		err = writeStatus(input, w, stack)
 		if err != nil {
 			// TODO: if w is stdout this is likely to fail as well.
-			log.Printf("call=tpl.Execute err=`%v`\n", err)
+			log.Printf("call=writeStatus err=`%v`\n", err)
 			return ErrOutputWriter
 		}
-	} else if len(parts) == 3 {
-		branch := parts[2]
-		_, err = fmt.Fprintf(w, simpleBranch, branch)
+	} else if len(parts) >= 3 {
+		err = writeStatus(input, w, &Stack{Branch: strings.Join(parts[2:], "/")})
 		if err != nil {
 			// TODO: if w is stdout this is likely to fail as well.
-			log.Printf("call=Fprintf err=`%v`\n", err)
+			log.Printf("call=writeStatus err=`%v`\n", err)
 			return ErrOutputWriter
 		}
 	}
@@ -449,9 +730,129 @@ func Status(_ Flags, w io.Writer) int {
 	return Success
 }
 
+// writeStatus renders s in the format selected by input. A Stack without a
+// Name describes a branch outside of a stack.
+func writeStatus(input Flags, w io.Writer, s *Stack) error {
+	switch {
+	case input.JSON:
+		return writeJSON(w, s)
+	case input.Porcelain:
+		return writePorcelain(w, s)
+	case s.Name == "":
+		_, err := fmt.Fprintf(w, simpleBranch, s.Branch)
+		return err
+	}
+	return stackTpl.Execute(w, s)
+}
+
+const (
+	stateAhead    = "+"
+	stateBehind   = "-"
+	stateSame     = "="
+	stateDiverged = "∇"
+)
+
+// tracking describes a local branch relative to its remote counterpart.
+type tracking struct {
+	State  string
+	Ahead  int
+	Behind int
+	// Counted is false when the branch is unpushed or the remote commit is not
+	// available locally and the counts are unknown.
+	Counted bool
+}
+
+// remoteState classifies the local commit relative to the remote sha by
+// counting the commits unique to each side. An empty sha indicates the branch
+// has not been pushed.
+func remoteState(repo *git.Repository, local plumbing.Hash, sha string) tracking {
+	if sha == "" {
+		return tracking{State: stateAhead}
+	}
+
+	if sha == local.String() {
+		return tracking{State: stateSame, Counted: true}
+	}
+
+	ahead, behind, err := aheadBehind(repo, local, plumbing.NewHash(sha))
+	if err != nil {
+		return tracking{State: stateDiverged}
+	}
+
+	t := tracking{Ahead: ahead, Behind: behind, Counted: true}
+	switch {
+	case ahead > 0 && behind > 0:
+		t.State = stateDiverged
+	case behind > 0:
+		t.State = stateBehind
+	case ahead > 0:
+		t.State = stateAhead
+	default:
+		t.State = stateSame
+	}
+	return t
+}
+
+// aheadBehind counts the commits reachable from local and remote respectively
+// that are not reachable from their merge base.
+func aheadBehind(repo *git.Repository, local, remote plumbing.Hash) (int, int, error) {
+	l, err := repo.CommitObject(local)
+	if err != nil {
+		return 0, 0, fmt.Errorf("call=CommitObject err=`%w`", err)
+	}
+
+	r, err := repo.CommitObject(remote)
+	if err != nil {
+		return 0, 0, fmt.Errorf("call=CommitObject err=`%w`", err)
+	}
+
+	bases, err := l.MergeBase(r)
+	if err != nil {
+		return 0, 0, fmt.Errorf("call=MergeBase err=`%w`", err)
+	}
+
+	var ignore []plumbing.Hash
+	for _, b := range bases {
+		ignore = append(ignore, b.Hash)
+	}
+
+	ahead, err := countCommits(l, ignore)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	behind, err := countCommits(r, ignore)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return ahead, behind, nil
+}
+
+func countCommits(c *object.Commit, ignore []plumbing.Hash) (int, error) {
+	var n int
+	err := object.NewCommitPreorderIter(c, nil, ignore).ForEach(func(*object.Commit) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("call=ForEach err=`%w`", err)
+	}
+	return n, nil
+}
+
 type branch struct {
-	Name   string
-	Status string
+	Name    string
+	SHA     string
+	Subject string
+	Current bool
+	tracking
+	Marker string
+	URL    string
+	// prState is the pull request state reported in JSON.
+	prState string
+	Merged  bool
+	hash    plumbing.Hash
 }
 
 type branches []branch
@@ -500,11 +901,15 @@ func openWorkTree() (*git.Repository, *git.Worktree, error) {
 
 var stackTpl = template.Must(template.New("stack").Parse(`In stack {{ .Name }}
 On branch {{ .Name }}/{{ .Branch }}
+{{ if .Base }}Based on {{ .Base }}
+{{ end -}}
 {{ if .Remote }}Remote {{ .Remote }}
 {{ end }}
-Local Stack{{ if .Remote }} (+ ahead, = same, ∇ diverged){{ end }}:
+Local Stack{{ if .Remote }} (+ ahead, - behind, = same, ∇ diverged){{ end }}:
 {{- range .Branches }}
-    {{ if .Status }}({{ .Status }}) {{ end }}{{ .Name }}{{ end }}
+  {{ if .Current }}*{{ else }} {{ end }} {{ if .State }}({{ .State }}) {{ end }}{{ printf "%-*s" $.Width .Name }} {{ .SHA }} {{ .Subject }}
+{{- if and .Counted (ne .State "=") }} [ahead {{ .Ahead }}, behind {{ .Behind }}]{{ end }}
+{{- if .Marker }} {{ .Marker }}{{ end }}{{ if .URL }} {{ .URL }}{{ end }}{{ end }}
 `))
 
 const simpleBranch = `Not in a stack
@@ -14,13 +14,3 @@ func Test_no_args_returns_missing_subcommand(t *testing.T) {
 	i := Exec(Flags{}, io.Discard)
 	assert.Int(t, i).Equals(ErrMissingSubCommand)
 }
-
-func Test_rebase_returns_success(t *testing.T) {
-	i := Exec(Flags{SubCommand: "rebase"}, io.Discard)
-	assert.Int(t, i).Equals(Success)
-}
-
-func Test_squash_returns_success(t *testing.T) {
-	i := Exec(Flags{SubCommand: "squash"}, io.Discard)
-	assert.Int(t, i).Equals(Success)
-}
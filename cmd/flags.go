@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// command describes the arguments accepted by a sub-command.
+type command struct {
+	// args is the positional argument shown in the help, empty when none.
+	args string
+	// required is true when the positional argument must be given.
+	required bool
+	flags    func(fs *flag.FlagSet, f *Flags)
+}
+
+func remoteFlag(fs *flag.FlagSet, f *Flags) {
+	fs.StringVar(&f.Remote, "remote", "", "remote to use instead of the default, origin or the first remote")
+}
+
+var commands = map[string]command{
+	"bottom": {},
+	"branch": {args: "<name>"},
+	"checkout": {args: "<index ID|name> | <stack>[/<index ID|name>]", flags: func(fs *flag.FlagSet, f *Flags) {
+		remoteFlag(fs, f)
+		fs.BoolVar(&f.Fetch, "fetch", false, "refresh the remote-tracking refs of a stack that is not local first")
+	}},
+	"delete": {args: "<stack>", flags: func(fs *flag.FlagSet, f *Flags) {
+		remoteFlag(fs, f)
+		fs.BoolVar(&f.RemoteBranches, "remote-branches", false, "also delete the stack's branches on the remote")
+		fs.BoolVar(&f.Force, "force", false, "delete layers that have not been merged into the trunk")
+	}},
+	"init": {args: "<stack>/<name>", flags: func(fs *flag.FlagSet, f *Flags) {
+		fs.StringVar(&f.Base, "base", "", "ref to start layer 001 from instead of HEAD")
+	}},
+	"insert": {args: "<name>"},
+	"list":   {},
+	"move": {args: "<index ID|name>", required: true, flags: func(fs *flag.FlagSet, f *Flags) {
+		fs.IntVar(&f.To, "to", 0, "position to move the branch to, starting at 1")
+	}},
+	"next": {},
+	"prev": {},
+	"pull": {flags: func(fs *flag.FlagSet, f *Flags) {
+		remoteFlag(fs, f)
+	}},
+	"push": {flags: func(fs *flag.FlagSet, f *Flags) {
+		remoteFlag(fs, f)
+		fs.BoolVar(&f.DryRun, "dry-run", false, "show what would be pushed and which pull requests would change")
+	}},
+	"rebase": {args: "[<trunk>]"},
+	"remote": {args: "[<remote>]"},
+	"rename": {args: "<new>", required: true, flags: func(fs *flag.FlagSet, f *Flags) {
+		remoteFlag(fs, f)
+		fs.BoolVar(&f.RemoteBranches, "remote-branches", false, "also delete the old branches on the remote and push the new ones")
+	}},
+	"squash": {args: "[<index ID>]"},
+	"status": {flags: func(fs *flag.FlagSet, f *Flags) {
+		remoteFlag(fs, f)
+		fs.BoolVar(&f.Fetch, "fetch", false, "refresh the remote-tracking refs and pull requests first")
+		fs.BoolVar(&f.JSON, "json", false, "write the status as versioned JSON")
+		fs.BoolVar(&f.Porcelain, "porcelain", false, "write the status as versioned space separated lines")
+	}},
+	"top":     {},
+	"version": {},
+}
+
+// printDefaults writes the flags of fs in the format of flag.PrintDefaults but
+// spelt with -- to match the usage line.
+func printDefaults(w io.Writer, fs *flag.FlagSet) {
+	fs.VisitAll(func(fl *flag.Flag) {
+		name, usage := flag.UnquoteUsage(fl)
+		fmt.Fprintf(w, "  --%s", fl.Name)
+		if name != "" {
+			fmt.Fprintf(w, " %s", name)
+		}
+		fmt.Fprintf(w, "\n    \t%s", usage)
+		switch fl.DefValue {
+		case "", "0", "false":
+		default:
+			fmt.Fprintf(w, " (default %q)", fl.DefValue)
+		}
+		fmt.Fprintln(w)
+	})
+}
+
+// ParseArgs parses the command line arguments that follow the program name.
+// Flags and positional arguments may be interleaved. flag.ErrHelp is returned
+// after the help for the program or a sub-command is written to w.
+func ParseArgs(args []string, w io.Writer) (Flags, error) {
+	var f Flags
+	if len(args) == 0 {
+		return f, nil
+	}
+	if args[0] == "-h" || args[0] == "--help" {
+		usage(w)
+		return f, flag.ErrHelp
+	}
+
+	f.SubCommand = args[0]
+	cmd, ok := commands[f.SubCommand]
+	if !ok {
+		return f, nil
+	}
+
+	fs := flag.NewFlagSet(f.SubCommand, flag.ContinueOnError)
+	fs.SetOutput(w)
+	if cmd.flags != nil {
+		cmd.flags(fs, &f)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(w, "usage: git stack %s", f.SubCommand)
+		fs.VisitAll(func(fl *flag.Flag) {
+			name, _ := flag.UnquoteUsage(fl)
+			if name == "" {
+				fmt.Fprintf(w, " [--%s]", fl.Name)
+			} else {
+				fmt.Fprintf(w, " [--%s <%s>]", fl.Name, name)
+			}
+		})
+		if cmd.args != "" {
+			fmt.Fprintf(w, " %s", cmd.args)
+		}
+		fmt.Fprintln(w)
+		printDefaults(w, fs)
+	}
+
+	var positional []string
+	rest := args[1:]
+	for {
+		err := fs.Parse(rest)
+		if err != nil {
+			return f, err
+		}
+
+		rest = fs.Args()
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		rest = rest[1:]
+	}
+
+	switch {
+	case len(positional) > 1 || (len(positional) == 1 && cmd.args == ""):
+		fs.Usage()
+		return f, fmt.Errorf("unexpected argument %q", positional[len(positional)-1])
+	case len(positional) == 1:
+		f.Name = positional[0]
+	case cmd.required:
+		fs.Usage()
+		return f, errors.New("missing argument " + cmd.args)
+	}
+
+	return f, nil
+}
+
+// Main parses args and executes the sub-command returning the exit code.
+func Main(args []string, stdout, stderr io.Writer) int {
+	input, err := ParseArgs(args, stderr)
+	if err == flag.ErrHelp {
+		return Success
+	} else if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return ErrInvalidArgument
+	}
+
+	return Exec(input, stdout)
+}
@@ -0,0 +1,103 @@
+package cmd_test
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"github.com/nfisher/gitit/assert"
+	. "github.com/nfisher/gitit/cmd"
+	"io"
+	"strings"
+	"testing"
+)
+
+func Test_parse_args(t *testing.T) {
+	td := map[string]struct {
+		args []string
+		want Flags
+	}{
+		"no args":          {nil, Flags{}},
+		"unknown command":  {[]string{"frobnicate", "--x"}, Flags{SubCommand: "frobnicate"}},
+		"positional":       {[]string{"branch", "003_ui"}, Flags{SubCommand: "branch", Name: "003_ui"}},
+		"remote separate":  {[]string{"push", "--remote", "upstream"}, Flags{SubCommand: "push", Remote: "upstream"}},
+		"remote equals":    {[]string{"pull", "--remote=upstream"}, Flags{SubCommand: "pull", Remote: "upstream"}},
+		"single dash":      {[]string{"status", "-fetch"}, Flags{SubCommand: "status", Fetch: true}},
+		"dry run":          {[]string{"push", "--dry-run"}, Flags{SubCommand: "push", DryRun: true}},
+		"flags after name": {[]string{"remote", "upstream"}, Flags{SubCommand: "remote", Name: "upstream"}},
+		"interleaved":      {[]string{"status", "--fetch", "--remote", "upstream"}, Flags{SubCommand: "status", Fetch: true, Remote: "upstream"}},
+	}
+
+	for name, tc := range td {
+		t.Run(name, func(t *testing.T) {
+			f, err := ParseArgs(tc.args, io.Discard)
+			if err != nil {
+				t.Fatalf("ParseArgs(%v) err=`%v`", tc.args, err)
+			}
+			if f != tc.want {
+				t.Errorf("ParseArgs(%v) = %+v, want %+v", tc.args, f, tc.want)
+			}
+		})
+	}
+}
+
+func Test_parse_args_errors(t *testing.T) {
+	td := map[string][]string{
+		"unknown flag":        {"push", "--fetch"},
+		"flag on no-flag cmd": {"branch", "--remote", "origin", "003_ui"},
+		"extra positional":    {"branch", "003_ui", "004_db"},
+		"unexpected arg":      {"status", "kb1234"},
+		"missing value":       {"push", "--remote"},
+	}
+
+	for name, args := range td {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseArgs(args, io.Discard)
+			if err == nil {
+				t.Errorf("ParseArgs(%v) err=nil, want error", args)
+			}
+		})
+	}
+}
+
+func Test_parse_args_help(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := ParseArgs([]string{"status", "--help"}, &buf)
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("err=`%v`, want flag.ErrHelp", err)
+	}
+	assert.String(t, buf.String()).Equals(`usage: git stack status [--fetch] [--json] [--porcelain] [--remote <string>]
+  --fetch
+    	refresh the remote-tracking refs and pull requests first
+  --json
+    	write the status as versioned JSON
+  --porcelain
+    	write the status as versioned space separated lines
+  --remote string
+    	remote to use instead of the default, origin or the first remote
+`)
+}
+
+func Test_main_help_returns_success(t *testing.T) {
+	var stderr bytes.Buffer
+	i := Main([]string{"rebase", "-h"}, io.Discard, &stderr)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, strings.SplitN(stderr.String(), "\n", 2)[0]).Equals("usage: git stack rebase [<trunk>]")
+}
+
+func Test_main_top_level_help_returns_success(t *testing.T) {
+	for _, arg := range []string{"-h", "--help"} {
+		var stderr bytes.Buffer
+		i := Main([]string{arg}, io.Discard, &stderr)
+		assert.Int(t, i).Equals(Success)
+		assert.String(t, strings.SplitN(stderr.String(), "\n", 2)[0]).Equals("usage: git stack <command> [<args>]")
+	}
+}
+
+func Test_main_unknown_flag_returns_invalid_argument(t *testing.T) {
+	var stderr bytes.Buffer
+	i := Main([]string{"checkout", "--force", "002"}, io.Discard, &stderr)
+	assert.Int(t, i).Equals(ErrInvalidArgument)
+	if !strings.Contains(stderr.String(), "error: flag provided but not defined: -force") {
+		t.Errorf("stderr=%q, want unknown flag error", stderr.String())
+	}
+}
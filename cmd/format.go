@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// statusVersion is the version of the machine-readable status formats. It is
+// incremented whenever a field is removed or its meaning changes; fields may
+// be added without a new version.
+const statusVersion = 1
+
+// Remote states in the machine-readable formats.
+const (
+	remoteNone     = "none"
+	remoteUnpushed = "unpushed"
+	remoteAhead    = "ahead"
+	remoteBehind   = "behind"
+	remoteSame     = "same"
+	remoteDiverged = "diverged"
+)
+
+type statusJSON struct {
+	Version int         `json:"version"`
+	Stack   string      `json:"stack"`
+	Branch  string      `json:"branch"`
+	Current string      `json:"current"`
+	Remote  string      `json:"remote,omitempty"`
+	Base    string      `json:"base,omitempty"`
+	Trunk   string      `json:"trunk,omitempty"`
+	Layers  []layerJSON `json:"layers"`
+}
+
+type layerJSON struct {
+	Name        string           `json:"name"`
+	Branch      string           `json:"branch"`
+	Sequence    int              `json:"sequence"`
+	SHA         string           `json:"sha"`
+	Subject     string           `json:"subject"`
+	Current     bool             `json:"current"`
+	Merged      bool             `json:"merged"`
+	Remote      remoteJSON       `json:"remote"`
+	PullRequest *pullRequestJSON `json:"pull_request,omitempty"`
+}
+
+type remoteJSON struct {
+	State string `json:"state"`
+	// Ahead and Behind are omitted when the counts are unknown.
+	Ahead  *int `json:"ahead,omitempty"`
+	Behind *int `json:"behind,omitempty"`
+}
+
+type pullRequestJSON struct {
+	URL   string `json:"url"`
+	State string `json:"state"`
+}
+
+// remoteStateName maps the tracking state to its machine-readable name.
+func remoteStateName(t tracking) string {
+	switch t.State {
+	case stateAhead:
+		if !t.Counted {
+			return remoteUnpushed
+		}
+		return remoteAhead
+	case stateBehind:
+		return remoteBehind
+	case stateSame:
+		return remoteSame
+	case stateDiverged:
+		return remoteDiverged
+	}
+	return remoteNone
+}
+
+// pullRequestState returns the machine-readable state of a pull request, one
+// of merged, closed, failing or open.
+func pullRequestState(pr PullRequest) string {
+	switch {
+	case pr.Merged:
+		return "merged"
+	case pr.State != "open":
+		return "closed"
+	case pr.Failing:
+		return "failing"
+	}
+	return "open"
+}
+
+// sequence returns the numeric prefix of a layer name such as 002_api.
+func sequence(name string) int {
+	n, _ := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+	return n
+}
+
+// writeJSON writes the stack status as a single JSON document. A branch
+// outside of a stack is reported with an empty stack and no layers.
+func writeJSON(w io.Writer, s *Stack) error {
+	v := statusJSON{
+		Version: statusVersion,
+		Stack:   s.Name,
+		Branch:  s.Branch,
+		Remote:  s.Remote,
+		Base:    s.Base,
+		Trunk:   s.Trunk,
+		Layers:  []layerJSON{},
+	}
+	if s.Name != "" {
+		v.Branch = s.Name + "/" + s.Branch
+		v.Current = s.Branch
+	}
+
+	for _, b := range s.Branches {
+		l := layerJSON{
+			Name:     b.Name,
+			Branch:   s.Name + "/" + b.Name,
+			Sequence: sequence(b.Name),
+			SHA:      b.hash.String(),
+			Subject:  b.Subject,
+			Current:  b.Current,
+			Merged:   b.Merged,
+			Remote:   remoteJSON{State: remoteStateName(b.tracking)},
+		}
+		if b.Counted {
+			ahead, behind := b.Ahead, b.Behind
+			l.Remote.Ahead, l.Remote.Behind = &ahead, &behind
+		}
+		if b.URL != "" {
+			l.PullRequest = &pullRequestJSON{URL: b.URL, State: b.prState}
+		}
+		v.Layers = append(v.Layers, l)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writePorcelain writes the stack status as space separated lines. Header
+// lines start with "# " followed by a key and value. Each layer line is:
+//
+//	layer <sequence> <current> <sha> <remote state> <ahead> <behind> <merged> <name>
+//
+// where current is "*" or ".", ahead and behind are "-" when unknown and
+// merged is "1" or "0".
+func writePorcelain(w io.Writer, s *Stack) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# version %d\n", statusVersion)
+	if s.Name == "" {
+		fmt.Fprintf(&b, "# branch %s\n", s.Branch)
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	fmt.Fprintf(&b, "# stack %s\n", s.Name)
+	fmt.Fprintf(&b, "# branch %s/%s\n", s.Name, s.Branch)
+	if s.Remote != "" {
+		fmt.Fprintf(&b, "# remote %s\n", s.Remote)
+	}
+	if s.Base != "" {
+		fmt.Fprintf(&b, "# base %s\n", s.Base)
+	}
+	if s.Trunk != "" {
+		fmt.Fprintf(&b, "# trunk %s\n", s.Trunk)
+	}
+
+	for _, l := range s.Branches {
+		current, merged := ".", "0"
+		if l.Current {
+			current = "*"
+		}
+		if l.Merged {
+			merged = "1"
+		}
+		ahead, behind := "-", "-"
+		if l.Counted {
+			ahead, behind = strconv.Itoa(l.Ahead), strconv.Itoa(l.Behind)
+		}
+		fmt.Fprintf(&b, "layer %03d %s %s %s %s %s %s %s\n",
+			sequence(l.Name), current, l.hash, remoteStateName(l.tracking), ahead, behind, merged, l.Name)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// gitCmd runs the git binary in the root of the repositories work tree. It is
+// used for operations go-git does not support such as rebase.
+func gitCmd(wt *git.Worktree, args ...string) (string, error) {
+	var buf bytes.Buffer
+	c := exec.Command("git", args...)
+	c.Dir = wt.Filesystem.Root()
+	c.Stdout = &buf
+	c.Stderr = &buf
+	err := c.Run()
+	if err != nil {
+		return buf.String(), fmt.Errorf("call=git args=`%v` err=`%w` output=`%s`", strings.Join(args, " "), err, strings.TrimSpace(buf.String()))
+	}
+	return buf.String(), nil
+}
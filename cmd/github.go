@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// PullRequest is the subset of a providers pull request used by the stack.
+type PullRequest struct {
+	Number  int
+	URL     string
+	Title   string
+	Body    string
+	Head    string
+	Base    string
+	State   string
+	Merged  bool
+	Failing bool
+}
+
+// PullRequestService manages the pull requests of a stack.
+type PullRequestService interface {
+	// List returns the open pull requests whose head branch is in stack.
+	List(stack string) ([]PullRequest, error)
+	// Create opens a new pull request.
+	Create(pr PullRequest) (PullRequest, error)
+	// Update changes the title, body and base of an existing pull request.
+	Update(pr PullRequest) (PullRequest, error)
+	// Lookup returns the most recent pull request for head in any state
+	// including its check status, nil if there is none.
+	Lookup(head string) (*PullRequest, error)
+	// RenameBranch renames a branch on the provider keeping its pull
+	// requests open and retargeting those based on it.
+	RenameBranch(old, new string) error
+}
+
+// NewPullRequestService returns the pull request service for the remote. A
+// nil service is returned when no provider credentials are configured.
+var NewPullRequestService = newGitHub
+
+const defaultGitHubAPI = "https://api.github.com"
+
+// newGitHub configures a GitHub client. The token is read from GITHUB_TOKEN,
+// the API from GITHUB_API_URL or stack.api and the repository from
+// stack.repository or the remote's URL.
+func newGitHub(repo *git.Repository, remote *git.Remote) (PullRequestService, error) {
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		return nil, nil
+	}
+
+	api := os.Getenv("GITHUB_API_URL")
+	if api == "" {
+		api = stackOption(repo, "api")
+	}
+	if api == "" {
+		api = defaultGitHubAPI
+	}
+
+	slug := stackOption(repo, "repository")
+	if slug == "" {
+		slug = repositorySlug(remote.Config().URLs[0])
+	}
+	if strings.Count(slug, "/") != 1 {
+		return nil, fmt.Errorf("unable to determine repository from remote, set stack.repository")
+	}
+
+	return &gitHub{
+		api:    strings.TrimSuffix(api, "/"),
+		slug:   slug,
+		token:  token,
+		client: http.DefaultClient,
+	}, nil
+}
+
+// stackOption returns the value of key in the repository's stack config section.
+func stackOption(repo *git.Repository, key string) string {
+	cfg, err := repo.Config()
+	if err != nil {
+		return ""
+	}
+	return cfg.Raw.Section("stack").Option(key)
+}
+
+// repositorySlug extracts owner/name from a remote URL such as
+// git@github.com:owner/name.git or https://github.com/owner/name.
+func repositorySlug(u string) string {
+	s := strings.TrimSuffix(u, ".git")
+	if p, err := url.Parse(s); err == nil && p.Host != "" {
+		s = p.Path
+	} else if i := strings.LastIndex(s, ":"); i >= 0 {
+		s = s[i+1:]
+	}
+
+	parts := strings.Split(strings.Trim(s, "/"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return strings.Join(parts[len(parts)-2:], "/")
+}
+
+type gitHub struct {
+	api    string
+	slug   string
+	token  string
+	client *http.Client
+}
+
+type gitHubRef struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha,omitempty"`
+}
+
+type gitHubPull struct {
+	Number   int       `json:"number,omitempty"`
+	HTMLURL  string    `json:"html_url,omitempty"`
+	Title    string    `json:"title"`
+	Body     string    `json:"body"`
+	State    string    `json:"state,omitempty"`
+	MergedAt *string   `json:"merged_at,omitempty"`
+	Head     gitHubRef `json:"head"`
+	Base     gitHubRef `json:"base"`
+}
+
+func (p gitHubPull) pullRequest() PullRequest {
+	return PullRequest{
+		Number: p.Number,
+		URL:    p.HTMLURL,
+		Title:  p.Title,
+		Body:   p.Body,
+		Head:   p.Head.Ref,
+		Base:   p.Base.Ref,
+		State:  p.State,
+		Merged: p.MergedAt != nil,
+	}
+}
+
+type gitHubStatus struct {
+	State string `json:"state"`
+}
+
+const pageSize = 100
+
+func (gh *gitHub) List(stack string) ([]PullRequest, error) {
+	var a []PullRequest
+	for page := 1; ; page++ {
+		var pulls []gitHubPull
+		path := fmt.Sprintf("/repos/%s/pulls?state=open&per_page=%d&page=%d", gh.slug, pageSize, page)
+		err := gh.do(http.MethodGet, path, nil, &pulls)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range pulls {
+			if strings.HasPrefix(p.Head.Ref, stack+"/") {
+				a = append(a, p.pullRequest())
+			}
+		}
+
+		if len(pulls) < pageSize {
+			return a, nil
+		}
+	}
+}
+
+func (gh *gitHub) Create(pr PullRequest) (PullRequest, error) {
+	req := map[string]string{
+		"title": pr.Title,
+		"body":  pr.Body,
+		"head":  pr.Head,
+		"base":  pr.Base,
+	}
+
+	var p gitHubPull
+	err := gh.do(http.MethodPost, fmt.Sprintf("/repos/%s/pulls", gh.slug), req, &p)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	return p.pullRequest(), nil
+}
+
+func (gh *gitHub) Update(pr PullRequest) (PullRequest, error) {
+	req := map[string]string{
+		"title": pr.Title,
+		"body":  pr.Body,
+		"base":  pr.Base,
+	}
+
+	var p gitHubPull
+	err := gh.do(http.MethodPatch, fmt.Sprintf("/repos/%s/pulls/%d", gh.slug, pr.Number), req, &p)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	return p.pullRequest(), nil
+}
+
+func (gh *gitHub) Lookup(head string) (*PullRequest, error) {
+	owner := strings.Split(gh.slug, "/")[0]
+	q := url.Values{
+		"state":    {"all"},
+		"head":     {owner + ":" + head},
+		"per_page": {"1"},
+	}
+
+	var pulls []gitHubPull
+	err := gh.do(http.MethodGet, fmt.Sprintf("/repos/%s/pulls?%s", gh.slug, q.Encode()), nil, &pulls)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pulls) == 0 {
+		return nil, nil
+	}
+
+	p := pulls[0]
+	pr := p.pullRequest()
+	if pr.State != "open" {
+		return &pr, nil
+	}
+
+	var status gitHubStatus
+	err = gh.do(http.MethodGet, fmt.Sprintf("/repos/%s/commits/%s/status", gh.slug, p.Head.SHA), nil, &status)
+	if err != nil {
+		return nil, err
+	}
+	pr.Failing = status.State == "failure" || status.State == "error"
+
+	return &pr, nil
+}
+
+func (gh *gitHub) RenameBranch(old, new string) error {
+	req := map[string]string{"new_name": new}
+	var out struct{}
+	return gh.do(http.MethodPost, fmt.Sprintf("/repos/%s/branches/%s/rename", gh.slug, old), req, &out)
+}
+
+func (gh *gitHub) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("call=Marshal err=`%w`", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, gh.api+path, body)
+	if err != nil {
+		return fmt.Errorf("call=NewRequest err=`%w`", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+gh.token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := gh.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("call=Do err=`%w`", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("call=%s path=%s status=%d body=`%s`", method, path, resp.StatusCode, bytes.TrimSpace(b))
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return fmt.Errorf("call=Decode err=`%w`", err)
+	}
+	return nil
+}
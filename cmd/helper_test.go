@@ -1,20 +1,32 @@
 package cmd_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	. "github.com/nfisher/gitit/cmd"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
 	"net"
 	"net/http"
 	"net/http/cgi"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func WorkTree(t *testing.T, repo *git.Repository) *git.Worktree {
@@ -26,6 +38,17 @@ func WorkTree(t *testing.T, repo *git.Repository) *git.Worktree {
 	return wt
 }
 
+// Reopen returns a fresh handle to repo so objects written by another process
+// or handle are visible.
+func Reopen(t *testing.T, repo *git.Repository) *git.Repository {
+	t.Helper()
+	r, err := git.PlainOpen(WorkTree(t, repo).Filesystem.Root())
+	if err != nil {
+		t.Fatalf("call=PlainOpen err=`%v`", err)
+	}
+	return r
+}
+
 func CreateBareDir(t *testing.T) func() {
 	t.Helper()
 
@@ -64,6 +87,7 @@ func CreateRepo(t *testing.T) (*git.Repository, func()) {
 	if err != nil {
 		t.Fatalf("call=PlainInit err=`%v`\n", err)
 	}
+	SetIdentity(t, repo)
 
 	return repo, func() {
 		os.Chdir(pwd)
@@ -71,6 +95,22 @@ func CreateRepo(t *testing.T) (*git.Repository, func()) {
 	}
 }
 
+// SetIdentity configures the committer used by the git binary in the repo.
+func SetIdentity(t *testing.T, repo *git.Repository) {
+	t.Helper()
+	cfg, err := repo.Config()
+	if err != nil {
+		t.Fatalf("call=Config err=`%v`\n", err)
+	}
+
+	cfg.User.Name = "Nate Fisher"
+	cfg.User.Email = "nate@fisher.com"
+	err = repo.SetConfig(cfg)
+	if err != nil {
+		t.Fatalf("call=SetConfig err=`%v`\n", err)
+	}
+}
+
 func Commit(t *testing.T, wt *git.Worktree, files map[string]string, msg string) {
 	t.Helper()
 	for n, c := range files {
@@ -85,6 +125,21 @@ func Commit(t *testing.T, wt *git.Worktree, files map[string]string, msg string)
 	}
 }
 
+// CommitAt commits files with the author and committer time set to when.
+func CommitAt(t *testing.T, wt *git.Worktree, files map[string]string, msg string, when time.Time) {
+	t.Helper()
+	for n, c := range files {
+		AddFile(t, wt, n, c)
+	}
+
+	_, err := wt.Commit(msg, &git.CommitOptions{
+		Author: &object.Signature{Email: "nate@fisher.com", Name: "Nate Fisher", When: when},
+	})
+	if err != nil {
+		t.Fatalf("call=Commit err=`%v`\n", err)
+	}
+}
+
 func CreateFile(t *testing.T, filename, contents string) {
 	t.Helper()
 	w, err := os.Create(filename)
@@ -152,6 +207,13 @@ func InitStack(t *testing.T, repo *git.Repository, stack, branch string) {
 	CreateBranch(t, repo, stack, branch)
 }
 
+// GitCmd runs the git binary in the current directory.
+func GitCmd(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	b, err := exec.Command("git", args...).CombinedOutput()
+	return string(b), err
+}
+
 func SkipWIP(t *testing.T, runWip bool) {
 	t.Helper()
 	if !runWip {
@@ -170,6 +232,13 @@ func (s *server) Address() string {
 }
 
 func LaunchServer(t *testing.T) (*server, func()) {
+	t.Helper()
+	return LaunchAuthServer(t, "", "")
+}
+
+// LaunchAuthServer launches a git server that requires basic auth when
+// username is not empty.
+func LaunchAuthServer(t *testing.T, username, password string) (*server, func()) {
 	// inspired by go-git tests.
 	l, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
@@ -185,11 +254,25 @@ func LaunchServer(t *testing.T) (*server, func()) {
 
 	backend := filepath.Join(strings.TrimSpace(string(b)), "git-http-backend")
 
+	var handler http.Handler = &cgi.Handler{
+		Path: backend,
+		Env:  []string{"GIT_HTTP_EXPORT_ALL=true", fmt.Sprintf("GIT_PROJECT_ROOT=%s", d)},
+	}
+	if username != "" {
+		next := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u, p, ok := r.BasicAuth()
+			if !ok || u != username || p != password {
+				w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
 	srv := http.Server{
-		Handler: &cgi.Handler{
-			Path: backend,
-			Env:  []string{"GIT_HTTP_EXPORT_ALL=true", fmt.Sprintf("GIT_PROJECT_ROOT=%s", d)},
-		},
+		Handler: handler,
 	}
 
 	repo, err := git.PlainInit(d, true)
@@ -224,9 +307,20 @@ var configContents = `[core]
 `
 
 func CreateRemote(t *testing.T, repo *git.Repository, s *server) {
+	t.Helper()
+	CreateNamedRemote(t, repo, "origin", s)
+}
+
+func CreateNamedRemote(t *testing.T, repo *git.Repository, name string, s *server) {
+	t.Helper()
+	CreateURLRemote(t, repo, name, s.Address())
+}
+
+func CreateURLRemote(t *testing.T, repo *git.Repository, name, url string) {
+	t.Helper()
 	_, err := repo.CreateRemote(&config.RemoteConfig{
-		Name: "origin",
-		URLs: []string{fmt.Sprintf("http://localhost:%d", s.Port)},
+		Name: name,
+		URLs: []string{url},
 	})
 	if err != nil {
 		t.Fatalf("call=CreateRemote err=`%v`\n", err)
@@ -258,6 +352,14 @@ func PushBranch(t *testing.T, repo *git.Repository, branchName string) {
 	}
 }
 
+func DeleteBranch(t *testing.T, repo *git.Repository, name string) {
+	t.Helper()
+	err := repo.Storer.RemoveReference(plumbing.NewBranchReferenceName(name))
+	if err != nil {
+		t.Fatalf("call=RemoveReference err=`%v`\n", err)
+	}
+}
+
 func CheckoutBranch(t *testing.T, wt *git.Worktree, name string) {
 	t.Helper()
 	err := wt.Checkout(&git.CheckoutOptions{
@@ -299,6 +401,7 @@ func CloneRepo(t *testing.T, s *server, name string) (*git.Repository, func()) {
 	if err != nil {
 		t.Fatalf("call=PlainClone err=`%v`\n", err)
 	}
+	SetIdentity(t, repo)
 
 	return repo, func() {
 		os.Chdir(pwd)
@@ -317,3 +420,422 @@ func FetchRefs(t *testing.T, repo *git.Repository, refs string) {
 		t.Fatalf("call=Fetch err=`%v`\n", err)
 	}
 }
+
+// SetStackOption sets key in the stack section of the repository config.
+func SetStackOption(t *testing.T, repo *git.Repository, key, value string) {
+	t.Helper()
+	cfg, err := repo.Config()
+	if err != nil {
+		t.Fatalf("call=Config err=`%v`\n", err)
+	}
+
+	cfg.Raw.Section("stack").SetOption(key, value)
+	err = repo.SetConfig(cfg)
+	if err != nil {
+		t.Fatalf("call=SetConfig err=`%v`\n", err)
+	}
+}
+
+type ref struct {
+	Ref string `json:"ref"`
+}
+
+type pull struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	State   string `json:"state"`
+	Head    ref    `json:"head"`
+	Base    ref    `json:"base"`
+}
+
+type gitHub struct {
+	sync.Mutex
+	Pulls []*pull
+	// Git is renamed along with the pull requests when a branch is renamed.
+	Git *server
+}
+
+// Bases returns head:base for each pull request in creation order.
+func (gh *gitHub) Bases() []string {
+	gh.Lock()
+	defer gh.Unlock()
+	var a []string
+	for _, p := range gh.Pulls {
+		a = append(a, p.Head.Ref+":"+p.Base.Ref)
+	}
+	return a
+}
+
+func (gh *gitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	gh.Lock()
+	defer gh.Unlock()
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/repos/nfisher/gitit/commits/"):
+		json.NewEncoder(w).Encode(map[string]string{"state": "success"})
+		return
+
+	case strings.HasPrefix(r.URL.Path, "/repos/nfisher/gitit/branches/") && strings.HasSuffix(r.URL.Path, "/rename"):
+		old := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/repos/nfisher/gitit/branches/"), "/rename")
+		var req struct {
+			NewName string `json:"new_name"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if gh.Git != nil {
+			b, err := exec.Command("git", "--git-dir", gh.Git.Root, "branch", "-m", old, req.NewName).CombinedOutput()
+			if err != nil {
+				http.Error(w, string(b), http.StatusUnprocessableEntity)
+				return
+			}
+		}
+		for _, p := range gh.Pulls {
+			if p.Head.Ref == old {
+				p.Head.Ref = req.NewName
+			}
+			if p.Base.Ref == old {
+				p.Base.Ref = req.NewName
+			}
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"name": req.NewName})
+		return
+
+	case !strings.HasPrefix(r.URL.Path, "/repos/nfisher/gitit/pulls"):
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		var a = []*pull{}
+		for _, p := range gh.Pulls {
+			if q.Get("state") != "all" && p.State != "open" {
+				continue
+			}
+			if q.Get("head") != "" && q.Get("head") != "nfisher:"+p.Head.Ref {
+				continue
+			}
+			a = append(a, p)
+		}
+		json.NewEncoder(w).Encode(a)
+
+	case http.MethodPost:
+		var req struct {
+			Title string `json:"title"`
+			Body  string `json:"body"`
+			Head  string `json:"head"`
+			Base  string `json:"base"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		p := &pull{
+			Number: len(gh.Pulls) + 1,
+			Title:  req.Title,
+			Body:   req.Body,
+			State:  "open",
+			Head:   ref{req.Head},
+			Base:   ref{req.Base},
+		}
+		p.HTMLURL = fmt.Sprintf("https://github.com/nfisher/gitit/pull/%d", p.Number)
+		gh.Pulls = append(gh.Pulls, p)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(p)
+
+	case http.MethodPatch:
+		var req struct {
+			Title string `json:"title"`
+			Body  string `json:"body"`
+			Base  string `json:"base"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, p := range gh.Pulls {
+			if r.URL.Path == fmt.Sprintf("/repos/nfisher/gitit/pulls/%d", p.Number) {
+				p.Title, p.Body, p.Base = req.Title, req.Body, ref{req.Base}
+				json.NewEncoder(w).Encode(p)
+				return
+			}
+		}
+		http.NotFound(w, r)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// LaunchGitHub starts a stand-in for the GitHub pull request API and points
+// the environment at it.
+func LaunchGitHub(t *testing.T, repo *git.Repository) (*gitHub, func()) {
+	t.Helper()
+	gh := &gitHub{}
+	srv := httptest.NewServer(gh)
+	t.Setenv("GITHUB_API_URL", srv.URL)
+	t.Setenv("GITHUB_TOKEN", "secret")
+	SetStackOption(t, repo, "repository", "nfisher/gitit")
+	return gh, srv.Close
+}
+
+type fakePullRequests map[string]PullRequest
+
+func (f fakePullRequests) List(stack string) ([]PullRequest, error) {
+	var a []PullRequest
+	for _, pr := range f {
+		if pr.State == "open" && strings.HasPrefix(pr.Head, stack+"/") {
+			a = append(a, pr)
+		}
+	}
+	return a, nil
+}
+
+func (f fakePullRequests) Create(pr PullRequest) (PullRequest, error) {
+	f[pr.Head] = pr
+	return pr, nil
+}
+
+func (f fakePullRequests) Update(pr PullRequest) (PullRequest, error) {
+	f[pr.Head] = pr
+	return pr, nil
+}
+
+func (f fakePullRequests) Lookup(head string) (*PullRequest, error) {
+	pr, ok := f[head]
+	if !ok {
+		return nil, nil
+	}
+	return &pr, nil
+}
+
+func (f fakePullRequests) RenameBranch(old, new string) error {
+	for head, pr := range f {
+		if pr.Base == old {
+			pr.Base = new
+		}
+		if head == old {
+			delete(f, head)
+			pr.Head = new
+			head = new
+		}
+		f[head] = pr
+	}
+	return nil
+}
+
+// FakePullRequests replaces the pull request provider with prs for the
+// duration of the test.
+func FakePullRequests(t *testing.T, prs ...PullRequest) {
+	t.Helper()
+	var f = fakePullRequests{}
+	for _, pr := range prs {
+		f[pr.Head] = pr
+	}
+
+	orig := NewPullRequestService
+	NewPullRequestService = func(*git.Repository, *git.Remote) (PullRequestService, error) {
+		return f, nil
+	}
+	t.Cleanup(func() {
+		NewPullRequestService = orig
+	})
+}
+
+type sshServer struct {
+	Port    int
+	Root    string
+	Repo    *git.Repository
+	HostKey ssh.PublicKey
+}
+
+// URL returns the ssh URL of the served repository for user.
+func (s *sshServer) URL(user string) string {
+	return fmt.Sprintf("ssh://%s@localhost:%d%s", user, s.Port, s.Root)
+}
+
+// KnownHostsLine returns the known_hosts entry for the server.
+func (s *sshServer) KnownHostsLine() string {
+	return knownhosts.Line([]string{fmt.Sprintf("[localhost]:%d", s.Port)}, s.HostKey) + "\n"
+}
+
+// LaunchSSHServer starts an SSH server that runs git-upload-pack and
+// git-receive-pack against a bare repository for user authenticating with key.
+func LaunchSSHServer(t *testing.T, user string, key ssh.PublicKey) (*sshServer, func()) {
+	t.Helper()
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("call=GenerateKey err=`%v`\n", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatalf("call=NewSignerFromKey err=`%v`\n", err)
+	}
+
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, k ssh.PublicKey) (*ssh.Permissions, error) {
+			if c.User() == user && bytes.Equal(k.Marshal(), key.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %s", c.User())
+		},
+	}
+	cfg.AddHostKey(hostSigner)
+
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("call=Listen err=`%v`\n", err)
+	}
+
+	d := t.TempDir()
+	repo, err := git.PlainInit(d, true)
+	if err != nil {
+		t.Fatalf("call=PlainInit err=`%v`\n", err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, cfg)
+		}
+	}()
+
+	return &sshServer{
+		Port:    l.Addr().(*net.TCPAddr).Port,
+		Root:    d,
+		Repo:    repo,
+		HostKey: hostSigner.PublicKey(),
+	}, func() { l.Close() }
+}
+
+func serveSSH(conn net.Conn, cfg *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+
+		ch, chreqs, err := nc.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer ch.Close()
+			for req := range chreqs {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+
+				// payload is a uint32 length prefixed command such as git-upload-pack '/repo'.
+				command := strings.Replace(string(req.Payload[4:]), "git-", "git ", 1)
+				c := exec.Command("sh", "-c", command)
+				c.Stdin = ch
+				c.Stdout = ch
+				c.Stderr = ch.Stderr()
+
+				var status struct{ Code uint32 }
+				if err := c.Run(); err != nil {
+					status.Code = 1
+				}
+				ch.SendRequest("exit-status", false, ssh.Marshal(&status))
+				return
+			}
+		}()
+	}
+}
+
+// GenerateIdentity writes a new ed25519 private key to path encrypted with
+// passphrase when it is not empty.
+func GenerateIdentity(t *testing.T, path, passphrase string) ssh.PublicKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("call=GenerateKey err=`%v`\n", err)
+	}
+
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(priv, "")
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatalf("call=MarshalPrivateKey err=`%v`\n", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		t.Fatalf("call=MkdirAll err=`%v`\n", err)
+	}
+
+	err = os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+	if err != nil {
+		t.Fatalf("call=WriteFile err=`%v`\n", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("call=NewSignerFromKey err=`%v`\n", err)
+	}
+	return signer.PublicKey()
+}
+
+// LaunchAgent serves an ssh agent holding the unencrypted key at path and
+// points SSH_AUTH_SOCK at it.
+func LaunchAgent(t *testing.T, path string) func() {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("call=ReadFile err=`%v`\n", err)
+	}
+
+	key, err := ssh.ParseRawPrivateKey(b)
+	if err != nil {
+		t.Fatalf("call=ParseRawPrivateKey err=`%v`\n", err)
+	}
+
+	keyring := agent.NewKeyring()
+	err = keyring.Add(agent.AddedKey{PrivateKey: key})
+	if err != nil {
+		t.Fatalf("call=Add err=`%v`\n", err)
+	}
+
+	// unix socket paths are limited in length so avoid the long test dirs.
+	d, err := os.MkdirTemp("", "agent")
+	if err != nil {
+		t.Fatalf("call=MkdirTemp err=`%v`\n", err)
+	}
+	sock := filepath.Join(d, "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("call=Listen err=`%v`\n", err)
+	}
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+
+	return func() {
+		l.Close()
+		os.RemoveAll(d)
+	}
+}
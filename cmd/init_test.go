@@ -52,3 +52,82 @@ func Test_init_returns_success_with_dirty_branch(t *testing.T) {
 	assert.Repo(t, repo).Branch("123/001_migration")
 	assert.Exists(t, ".gitignore")
 }
+
+func Test_init_records_stack_metadata(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	InitialCommit(t, repo)
+
+	i := Exec(Flags{SubCommand: "init", Name: "123/migration"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	for k, want := range map[string]string{"base": "master\n", "trunk": "master\n"} {
+		got, err := GitCmd(t, "config", "--get", "stack.123."+k)
+		if err != nil {
+			t.Fatalf("call=GitCmd key=%s err=`%v` output=`%s`", k, err, got)
+		}
+		assert.String(t, got).Equals(want)
+	}
+
+	_, err := GitCmd(t, "config", "--get", "stack.123.created")
+	if err != nil {
+		t.Errorf("stack.123.created not recorded err=`%v`", err)
+	}
+}
+
+func Test_init_starts_from_base(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	InitialCommit(t, repo)
+	wt := WorkTree(t, repo)
+	CreateBranch(t, repo, "feature", "base")
+	Commit(t, wt, map[string]string{"base.go": "package base"}, "Add base.go")
+	CheckoutBranch(t, wt, "master")
+
+	i := Exec(Flags{SubCommand: "init", Name: "123/migration", Base: "feature/base"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assert.Repo(t, repo).Branch("123/001_migration")
+	assert.Repo(t, repo).IsAncestor("feature/base", "123/001_migration")
+	assert.Exists(t, "base.go")
+
+	got, err := GitCmd(t, "config", "--get", "stack.123.base")
+	if err != nil {
+		t.Fatalf("call=GitCmd err=`%v` output=`%s`", err, got)
+	}
+	assert.String(t, got).Equals("feature/base\n")
+}
+
+func Test_init_with_unknown_base_fails(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	InitialCommit(t, repo)
+
+	i := Exec(Flags{SubCommand: "init", Name: "123/migration", Base: "nope"}, io.Discard)
+	assert.Int(t, i).Equals(ErrUnknownBranch)
+	assert.Repo(t, repo).Branch("master")
+}
+
+func Test_init_refuses_existing_stack(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	CreateThreeLayerStack(t, repo)
+
+	i := Exec(Flags{SubCommand: "init", Name: "kb1234/other"}, io.Discard)
+	assert.Int(t, i).Equals(ErrStackExists)
+	assert.Repo(t, repo).Branch("kb1234/003_ui")
+}
+
+func Test_init_rejects_invalid_ref_names(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	InitialCommit(t, repo)
+
+	for _, name := range []string{"123/bad..name", "12 3/migration", "123/mig~ration", "123/", ".123/migration", "123/migration.lock"} {
+		i := Exec(Flags{SubCommand: "init", Name: name}, io.Discard)
+		if i != ErrInvalidArgument {
+			t.Errorf("init %q = %d, want %d", name, i, ErrInvalidArgument)
+		}
+	}
+	assert.Repo(t, repo).Branch("master")
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Insert creates a layer directly above the current one. Higher layers whose
+// sequence would collide are renumbered, they already sit on top of the new
+// layer as it starts at the tip of the current one.
+func Insert(input Flags, w io.Writer) int {
+	if input.Name == "" {
+		log.Printf("call=Name err=`branch name is empty, must be specified`\n")
+		return ErrMissingArguments
+	}
+
+	repo, wt, err := openWorkTree()
+	if err != nil {
+		log.Printf("call=openWorkTree err=`%v`\n", err)
+		return ErrNotRepository
+	}
+
+	parts, err := headParts(repo)
+	if err != nil {
+		log.Printf("call=headParts err=`%v`\n", err)
+		return ErrHead
+	}
+
+	if !isStack(parts) {
+		log.Printf("call=Split err=`want 4 parts, got %d`\n", len(parts))
+		return ErrInvalidStack
+	}
+
+	stack := parts[stackName]
+	name := layerName(stack, sequence(parts[stackBranch])+1, input.Name)
+	if strings.Contains(input.Name, "/") {
+		log.Printf("call=Contains err=`%s is not a valid layer name`\n", input.Name)
+		return ErrInvalidArgument
+	}
+	if err := plumbing.NewBranchReferenceName(name).Validate(); err != nil {
+		log.Printf("call=Validate name=%s err=`%v`\n", name, err)
+		return ErrInvalidArgument
+	}
+
+	layers, err := stackLayers(repo, stack)
+	if err != nil {
+		log.Printf("call=stackLayers err=`%v`\n", err)
+		return ErrUnknownBranch
+	}
+
+	// shift the layers above while their sequence collides with the one
+	// below, highest first so a new name is never taken.
+	var renames []rename
+	next := sequence(parts[stackBranch]) + 1
+	for _, l := range layers {
+		seq := layerSeq(l)
+		if seq <= sequence(parts[stackBranch]) {
+			continue
+		}
+		if seq != next {
+			break
+		}
+		next++
+		renames = append([]rename{{old: l, new: layerName(stack, next, layerDesc(l))}}, renames...)
+	}
+
+	err = renameBranches(repo, stack, renames, w)
+	if err != nil {
+		log.Printf("call=renameBranches err=`%v`\n", err)
+		return ErrCreatingBranch
+	}
+
+	err = wt.Checkout(&git.CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName(name),
+		Create: true,
+		Keep:   true,
+	})
+	if err != nil {
+		log.Printf("call=Checkout err=`%v`\n", err)
+		return ErrCreatingBranch
+	}
+
+	fmt.Fprintln(w, "Created branch", name)
+	return Success
+}
@@ -0,0 +1,109 @@
+package cmd_test
+
+import (
+	"bytes"
+	"github.com/nfisher/gitit/assert"
+	. "github.com/nfisher/gitit/cmd"
+	"io"
+	"testing"
+)
+
+func Test_insert_returns_missing_arguments_without_name(t *testing.T) {
+	i := Exec(Flags{SubCommand: "insert"}, io.Discard)
+	assert.Int(t, i).Equals(ErrMissingArguments)
+}
+
+func Test_insert_outside_stack_fails(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	InitialCommit(t, repo)
+
+	i := Exec(Flags{SubCommand: "insert", Name: "schema"}, io.Discard)
+	assert.Int(t, i).Equals(ErrInvalidStack)
+}
+
+func Test_insert_rejects_invalid_layer_names(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	CreateThreeLayerStack(t, repo)
+
+	for _, name := range []string{"sch/ema", "sch ema", "sch..ema", "schema.lock", "sch~ema"} {
+		i := Exec(Flags{SubCommand: "insert", Name: name}, io.Discard)
+		if i != ErrInvalidArgument {
+			t.Errorf("insert %q = %d, want %d", name, i, ErrInvalidArgument)
+		}
+	}
+	assert.Repo(t, repo).Branch("kb1234/003_ui")
+}
+
+func Test_insert_renumbers_higher_layers(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	CreateThreeLayerStack(t, repo)
+	CheckoutBranch(t, WorkTree(t, repo), "kb1234/001_docs")
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "insert", Name: "schema"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`Renamed branch kb1234/003_ui to kb1234/004_ui
+Renamed branch kb1234/002_api to kb1234/003_api
+Created branch kb1234/002_schema
+`)
+	assert.Repo(t, repo).Branch("kb1234/002_schema")
+	assert.Repo(t, repo).ExcludesBranches("kb1234/002_api", "kb1234/003_ui")
+	assert.Repo(t, repo).Parent("kb1234/003_api", "kb1234/002_schema")
+	assert.Repo(t, repo).Parent("kb1234/004_ui", "kb1234/003_api")
+}
+
+func Test_insert_fills_gap_without_renumbering(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	wt := WorkTree(t, repo)
+	InitialCommit(t, repo)
+	InitStack(t, repo, "kb1234", "001_docs")
+	Commit(t, wt, map[string]string{"README.md": "Hello world"}, "Add README.md")
+	CreateBranch(t, repo, "kb1234", "003_ui")
+	Commit(t, wt, map[string]string{"ui.js": "function ui() {}"}, "Add ui.js")
+	CheckoutBranch(t, wt, "kb1234/001_docs")
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "insert", Name: "api"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals("Created branch kb1234/002_api\n")
+	assert.Repo(t, repo).IncludesBranches("kb1234/001_docs", "kb1234/002_api", "kb1234/003_ui")
+}
+
+func Test_push_after_insert_removes_renamed_branches(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+	t.Setenv("GITHUB_TOKEN", "")
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	CheckoutBranch(t, WorkTree(t, repo), "kb1234/001_docs")
+	i = Exec(Flags{SubCommand: "insert", Name: "schema"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	var buf bytes.Buffer
+	i = Exec(Flags{SubCommand: "push"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`Deleted renamed kb1234/002_api on origin
+Deleted renamed kb1234/003_ui on origin
+`)
+	assert.Remote(t, server.Address()).IncludesBranches(
+		"kb1234/001_docs",
+		"kb1234/002_schema",
+		"kb1234/003_api",
+		"kb1234/004_ui")
+	assert.Remote(t, server.Address()).ExcludesBranches(
+		"kb1234/002_api",
+		"kb1234/003_ui")
+}
@@ -0,0 +1,357 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// rename is a change of a branch name from old to new, both in the form
+// <stack>/NNN_name.
+type rename struct {
+	old, new string
+}
+
+// layerName returns the branch name for the layer of stack at seq.
+func layerName(stack string, seq int, desc string) string {
+	return fmt.Sprintf("%s/%03d_%s", stack, seq, desc)
+}
+
+// layerSeq returns the sequence of a layer such as 2 for kb1234/002_api.
+func layerSeq(layer string) int {
+	p := strings.SplitN(layer, "/", 2)
+	return sequence(p[len(p)-1])
+}
+
+// layerDesc returns the description of a layer such as api for kb1234/002_api.
+func layerDesc(layer string) string {
+	p := strings.SplitN(layer, "/", 2)
+	return p[len(p)-1][strings.Index(p[len(p)-1], "_")+1:]
+}
+
+// renameBranches renames the local branches in the order given along with
+// their branch config and HEAD when it points at one of them. The old names
+// are recorded against stack so the next push removes them from the remote.
+func renameBranches(repo *git.Repository, stack string, renames []rename, w io.Writer) error {
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("call=Head err=`%w`", err)
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("call=Config err=`%w`", err)
+	}
+
+	for _, r := range renames {
+		oldName := plumbing.NewBranchReferenceName(r.old)
+		newName := plumbing.NewBranchReferenceName(r.new)
+		ref, err := repo.Reference(oldName, false)
+		if err != nil {
+			return fmt.Errorf("call=Reference branch=%s err=`%w`", r.old, err)
+		}
+
+		if _, err := repo.Reference(newName, false); err == nil {
+			return fmt.Errorf("branch %s already exists", r.new)
+		}
+
+		err = repo.Storer.SetReference(plumbing.NewHashReference(newName, ref.Hash()))
+		if err != nil {
+			return fmt.Errorf("call=SetReference err=`%w`", err)
+		}
+
+		if head.Name() == oldName {
+			err = repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, newName))
+			if err != nil {
+				return fmt.Errorf("call=SetReference err=`%w`", err)
+			}
+		}
+
+		err = repo.Storer.RemoveReference(oldName)
+		if err != nil {
+			return fmt.Errorf("call=RemoveReference err=`%w`", err)
+		}
+
+		if b, ok := cfg.Branches[r.old]; ok {
+			delete(cfg.Branches, r.old)
+			b.Name = r.new
+			cfg.Branches[r.new] = b
+		}
+		fmt.Fprintf(w, "Renamed branch %s to %s\n", r.old, r.new)
+	}
+
+	// pending maps the local name to the name last pushed to the remote.
+	sub := cfg.Raw.Section("stack").Subsection(stack)
+	var pending = map[string]string{}
+	for _, v := range sub.Options.GetAll("renamed") {
+		if o, n, ok := strings.Cut(v, " "); ok {
+			pending[n] = o
+		}
+	}
+	for _, r := range renames {
+		o, ok := pending[r.old]
+		if !ok {
+			o = r.old
+		}
+		delete(pending, r.old)
+		pending[r.new] = o
+	}
+
+	sub.RemoveOption("renamed")
+	for _, n := range slices.Sorted(maps.Keys(pending)) {
+		if o := pending[n]; o != n {
+			sub.AddOption("renamed", o+" "+n)
+		}
+	}
+
+	err = repo.SetConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("call=SetConfig err=`%w`", err)
+	}
+	return nil
+}
+
+// renamedBranches returns the branches of stack renamed locally since the
+// stack was last pushed with old as the name on the remote.
+func renamedBranches(repo *git.Repository, stack string) []rename {
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil
+	}
+
+	s := cfg.Raw.Section("stack")
+	if !s.HasSubsection(stack) {
+		return nil
+	}
+
+	var a []rename
+	for _, v := range s.Subsection(stack).Options.GetAll("renamed") {
+		if o, n, ok := strings.Cut(v, " "); ok {
+			a = append(a, rename{old: o, new: n})
+		}
+	}
+	return a
+}
+
+// remoteBranches returns the set of branch names on remote.
+func remoteBranches(repo *git.Repository, remote *git.Remote) (map[string]bool, error) {
+	var refs []*plumbing.Reference
+	err := withAuth(repo, remote, func(authcb transport.AuthMethod) error {
+		var err error
+		refs, err = remote.List(&git.ListOptions{Auth: authcb})
+		return err
+	})
+	if err != nil && err != transport.ErrEmptyRemoteRepository {
+		return nil, fmt.Errorf("call=List err=`%w`", err)
+	}
+
+	var exists = map[string]bool{}
+	for _, r := range refs {
+		if r.Name().IsBranch() {
+			exists[r.Name().Short()] = true
+		}
+	}
+	return exists, nil
+}
+
+// renameRemote renames the remote branches of stack that were renamed locally
+// through the pull request service, which keeps their pull requests open and
+// retargets the ones based on them, then force pushes the new names. The
+// renames left for pruneRenamed to delete once the new names are pushed are
+// returned, that is all of them when there is no pull request service.
+func renameRemote(repo *git.Repository, remote *git.Remote, stack string, dryRun bool, w io.Writer) ([]rename, error) {
+	renames := renamedBranches(repo, stack)
+	if len(renames) == 0 {
+		return nil, nil
+	}
+
+	exists, err := remoteBranches(repo, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	svc, err := NewPullRequestService(repo, remote)
+	if err != nil {
+		return nil, fmt.Errorf("call=NewPullRequestService err=`%w`", err)
+	}
+
+	name := remote.Config().Name
+	var stale []rename
+	var specs []config.RefSpec
+	for _, r := range renames {
+		if !exists[r.old] {
+			continue
+		}
+		if svc == nil || exists[r.new] {
+			stale = append(stale, r)
+			continue
+		}
+		if dryRun {
+			fmt.Fprintf(w, "Would rename %s to %s on %s\n", r.old, r.new, name)
+			continue
+		}
+
+		err = svc.RenameBranch(r.old, r.new)
+		if err != nil {
+			log.Printf("call=RenameBranch branch=%s err=`%v`\n", r.old, err)
+			stale = append(stale, r)
+			continue
+		}
+		fmt.Fprintf(w, "Renamed %s to %s on %s\n", r.old, r.new, name)
+		_ = repo.Storer.RemoveReference(plumbing.NewRemoteReferenceName(name, r.old))
+		specs = append(specs, config.RefSpec(fmt.Sprintf("+refs/heads/%[1]s:refs/heads/%[1]s", r.new)))
+	}
+
+	// the renamed branches still hold the commits from before the rename.
+	if len(specs) > 0 {
+		err = withAuth(repo, remote, func(authcb transport.AuthMethod) error {
+			return repo.Push(&git.PushOptions{
+				Auth:       authcb,
+				RemoteName: name,
+				RefSpecs:   specs,
+			})
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return nil, fmt.Errorf("call=Push err=`%w`", err)
+		}
+	}
+
+	return stale, nil
+}
+
+// pruneRenamed deletes the stale remote branches left by renameRemote and
+// forgets the pending renames of stack. It is called once the new names are
+// pushed so a failed push never loses a layer. GitHub closes the pull requests
+// of deleted branches and a new one is opened for the renamed branch.
+func pruneRenamed(repo *git.Repository, remote *git.Remote, stack string, stale []rename, dryRun bool, w io.Writer) error {
+	renames := renamedBranches(repo, stack)
+	if len(renames) == 0 {
+		return nil
+	}
+
+	name := remote.Config().Name
+	var specs []config.RefSpec
+	for _, r := range stale {
+		if dryRun {
+			fmt.Fprintf(w, "Would delete renamed %s on %s\n", r.old, name)
+			continue
+		}
+		specs = append(specs, config.RefSpec(":"+plumbing.NewBranchReferenceName(r.old).String()))
+	}
+	if dryRun {
+		return nil
+	}
+
+	if len(specs) > 0 {
+		err := withAuth(repo, remote, func(authcb transport.AuthMethod) error {
+			return repo.Push(&git.PushOptions{
+				Auth:       authcb,
+				RemoteName: name,
+				RefSpecs:   specs,
+			})
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return fmt.Errorf("call=Push err=`%w`", err)
+		}
+	}
+
+	for _, r := range stale {
+		fmt.Fprintf(w, "Deleted renamed %s on %s\n", r.old, name)
+	}
+	// stale remote-tracking refs would otherwise report the old layers.
+	for _, r := range renames {
+		_ = repo.Storer.RemoveReference(plumbing.NewRemoteReferenceName(name, r.old))
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("call=Config err=`%w`", err)
+	}
+	cfg.Raw.Section("stack").Subsection(stack).RemoveOption("renamed")
+	err = repo.SetConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("call=SetConfig err=`%w`", err)
+	}
+	return nil
+}
+
+// ambiguousError reports every layer matching a query.
+type ambiguousError struct {
+	query      string
+	candidates []string
+}
+
+func (e *ambiguousError) Error() string {
+	return fmt.Sprintf("%q matches %s", e.query, strings.Join(e.candidates, ", "))
+}
+
+var errNoLayer = errors.New("no matching layer")
+
+// matchLayer returns the layer of layers, in the form <stack>/NNN_name,
+// matching query. A number matches the sequence so 2 and 002 match 002_api,
+// otherwise the full name, the description and finally a case-insensitive
+// part of the description are tried in turn. Only a single match is returned.
+func matchLayer(layers []string, query string) (string, error) {
+	short := func(l string) string {
+		return l[strings.Index(l, "/")+1:]
+	}
+
+	var matchers []func(l string) bool
+	if n, err := strconv.Atoi(query); err == nil {
+		matchers = append(matchers, func(l string) bool { return layerSeq(l) == n })
+	}
+	q := strings.ToLower(query)
+	matchers = append(matchers,
+		func(l string) bool { return short(l) == query },
+		func(l string) bool { return layerDesc(l) == query },
+		func(l string) bool { return strings.Contains(strings.ToLower(layerDesc(l)), q) },
+	)
+
+	for _, m := range matchers {
+		var found []string
+		for _, l := range layers {
+			if m(l) {
+				found = append(found, l)
+			}
+		}
+
+		switch len(found) {
+		case 0:
+			continue
+		case 1:
+			return found[0], nil
+		}
+		return "", &ambiguousError{query: query, candidates: found}
+	}
+
+	return "", errNoLayer
+}
+
+// findLayer matches query against layers writing the candidates to w when it
+// is ambiguous.
+func findLayer(layers []string, query string, w io.Writer) (string, int) {
+	l, err := matchLayer(layers, query)
+	var ambiguous *ambiguousError
+	switch {
+	case errors.As(err, &ambiguous):
+		fmt.Fprintf(w, "%s is ambiguous, candidates are:\n", query)
+		for _, c := range ambiguous.candidates {
+			fmt.Fprintf(w, "  %s\n", c)
+		}
+		return "", ErrAmbiguousBranch
+	case err != nil:
+		log.Printf("call=matchLayer query=%s err=`%v`\n", query, err)
+		return "", ErrUnknownBranch
+	}
+	return l, Success
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+const (
+	pushedLocal    = "local"
+	pushedNone     = "unpushed"
+	pushedAll      = "pushed"
+	pushedOutdated = "changed"
+)
+
+// stackSummary describes a stack in the output of list.
+type stackSummary struct {
+	Name    string
+	Current bool
+	Layers  int
+	Age     string
+	Pushed  string
+}
+
+// List writes every stack in the repository with its layer count, the age of
+// its top layer and whether it matches the remote-tracking refs.
+func List(input Flags, w io.Writer) int {
+	repo, _, err := openWorkTree()
+	if err != nil {
+		log.Printf("call=openWorkTree err=`%v`\n", err)
+		return ErrNotRepository
+	}
+
+	var current string
+	if parts, err := headParts(repo); err == nil && isStack(parts) {
+		current = parts[stackName]
+	}
+
+	var layers = map[string][]*plumbing.Reference{}
+	fn := func(reference *plumbing.Reference) error {
+		p := splitRef(reference)
+		if isStack(p) {
+			layers[p[stackName]] = append(layers[p[stackName]], reference)
+		}
+		return nil
+	}
+
+	err = branchesApply(repo, fn)
+	if err != nil {
+		log.Printf("call=branchesApply err=`%v`\n", err)
+		return ErrUnknownBranch
+	}
+
+	var stacks []stackSummary
+	now := time.Now()
+	for name, refs := range layers {
+		sort.Slice(refs, func(i, j int) bool {
+			return refs[i].Name() < refs[j].Name()
+		})
+
+		tip, err := repo.CommitObject(refs[len(refs)-1].Hash())
+		if err != nil {
+			log.Printf("call=CommitObject err=`%v`\n", err)
+			return ErrUnknownBranch
+		}
+
+		stacks = append(stacks, stackSummary{
+			Name:    name,
+			Current: name == current,
+			Layers:  len(refs),
+			Age:     age(now.Sub(tip.Committer.When)),
+			Pushed:  pushedState(repo, name, refs),
+		})
+	}
+
+	sort.Slice(stacks, func(i, j int) bool {
+		return stacks[i].Name < stacks[j].Name
+	})
+
+	var width int
+	for _, s := range stacks {
+		width = max(width, len(s.Name))
+	}
+
+	err = listTpl.Execute(w, map[string]any{"Width": width, "Stacks": stacks})
+	if err != nil {
+		log.Printf("call=tpl.Execute err=`%v`\n", err)
+		return ErrOutputWriter
+	}
+
+	return Success
+}
+
+// pushedState compares the layers of stack with the remote-tracking refs of
+// its remote.
+func pushedState(repo *git.Repository, stack string, refs []*plumbing.Reference) string {
+	remote, err := selectRemote(repo, "", stack)
+	if err != nil {
+		return pushedLocal
+	}
+
+	name := remote.Config().Name
+	tracking, err := trackingRefs(repo, name, stack)
+	if err != nil || len(tracking) == 0 {
+		return pushedNone
+	}
+
+	var remoteShas = map[string]plumbing.Hash{}
+	for _, r := range tracking {
+		remoteShas[strings.TrimPrefix(r.Name().String(), trackingPrefix(name, stack))] = r.Hash()
+	}
+
+	for _, r := range refs {
+		h, ok := remoteShas[splitRef(r)[stackBranch]]
+		if !ok || h != r.Hash() {
+			return pushedOutdated
+		}
+	}
+	return pushedAll
+}
+
+// age formats d in the style of git's relative dates.
+func age(d time.Duration) string {
+	unit := func(n int, name string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", name)
+		}
+		return fmt.Sprintf("%d %ss ago", n, name)
+	}
+
+	day := 24 * time.Hour
+	switch {
+	case d < 90*time.Second:
+		return unit(int(d/time.Second), "second")
+	case d < 90*time.Minute:
+		return unit(int(d/time.Minute), "minute")
+	case d < 36*time.Hour:
+		return unit(int(d/time.Hour), "hour")
+	case d < 14*day:
+		return unit(int(d/day), "day")
+	case d < 70*day:
+		return unit(int(d/(7*day)), "week")
+	case d < 365*day:
+		return unit(int(d/(30*day)), "month")
+	}
+	return unit(int(d/(365*day)), "year")
+}
+
+var listTpl = template.Must(template.New("list").Parse(`
+{{- range .Stacks }}{{ if .Current }}*{{ else }} {{ end }} {{ printf "%-*s" $.Width .Name }} {{ printf "%3d" .Layers }} {{ if eq .Layers 1 }}layer {{ else }}layers{{ end }} {{ printf "%-8s" .Pushed }} {{ .Age }}
+{{ end }}`))
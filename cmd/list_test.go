@@ -0,0 +1,91 @@
+package cmd_test
+
+import (
+	"bytes"
+	"github.com/go-git/go-git/v5"
+	"github.com/nfisher/gitit/assert"
+	. "github.com/nfisher/gitit/cmd"
+	"io"
+	"testing"
+	"time"
+)
+
+func Test_list_outside_repo_should_fail(t *testing.T) {
+	tdclose := CreateBareDir(t)
+	defer tdclose()
+
+	i := Exec(Flags{SubCommand: "list"}, io.Discard)
+	assert.Int(t, i).Equals(ErrNotRepository)
+}
+
+func Test_list_without_stacks_is_empty(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	InitialCommit(t, repo)
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "list"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals("")
+}
+
+func createAgedStacks(t *testing.T, repo *git.Repository) {
+	t.Helper()
+	wt := WorkTree(t, repo)
+	now := time.Now()
+	InitialCommit(t, repo)
+	InitStack(t, repo, "kb3456", "001_migration")
+	CommitAt(t, wt, map[string]string{"001_create.sql": "SELECT 1;"}, "Add 001_create.sql", now.Add(-3*time.Hour))
+	CheckoutBranch(t, wt, "master")
+	InitStack(t, repo, "kb1234", "001_docs")
+	CommitAt(t, wt, map[string]string{"README.md": "Hello world"}, "Add README.md", now.Add(-30*24*time.Hour))
+	CreateBranch(t, repo, "kb1234", "002_api")
+	CommitAt(t, wt, map[string]string{"api.js": "function api() {}"}, "Add api.js", now.Add(-2*24*time.Hour))
+}
+
+func Test_list_shows_every_stack(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	createAgedStacks(t, repo)
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "list"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`* kb1234   2 layers local    2 days ago
+  kb3456   1 layer  local    3 hours ago
+`)
+}
+
+func Test_list_ignores_non_stack_branches(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	createAgedStacks(t, repo)
+	CreateBranch(t, repo, "feature", "x")
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "list"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`  kb1234   2 layers local    2 days ago
+  kb3456   1 layer  local    3 hours ago
+`)
+}
+
+func Test_list_shows_pushed_state(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	createAgedStacks(t, repo)
+	CreateRemote(t, repo, server)
+	PushBranch(t, repo, "kb3456/001_migration")
+	PushBranch(t, repo, "kb1234/001_docs")
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "list"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`* kb1234   2 layers changed  2 days ago
+  kb3456   1 layer  pushed   3 hours ago
+`)
+}
@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// layerBranches returns a branch for each layer pointing at its tip.
+func layerBranches(repo *git.Repository, layers []string) (branches, error) {
+	var b branches
+	for _, l := range layers {
+		ref, err := repo.Reference(plumbing.NewBranchReferenceName(l), true)
+		if err != nil {
+			return nil, fmt.Errorf("call=Reference err=`%w`", err)
+		}
+		b = append(b, branch{Name: l, hash: ref.Hash()})
+	}
+	return b, nil
+}
+
+// markMerged flags every layer whose changes have landed on trunk either by
+// a regular merge or by a squash merge with an identical patch.
+func markMerged(repo *git.Repository, trunk string, b branches) error {
+	if len(b) == 0 {
+		return nil
+	}
+
+	trunkTip, err := branchCommit(repo, trunk)
+	if err != nil {
+		return err
+	}
+
+	first, err := repo.CommitObject(b[0].hash)
+	if err != nil {
+		return fmt.Errorf("call=CommitObject err=`%w`", err)
+	}
+
+	base, err := forkPoint(trunkTip, first)
+	if err != nil || base == nil {
+		return err
+	}
+
+	// only trunk commits touching the same paths as a layer that is not
+	// reachable from trunk can be its squash merge, which keeps the number of
+	// patches computed small on a busy trunk.
+	var tips = make([]*object.Commit, len(b))
+	var ranges = make([]*object.Commit, len(b))
+	var keys = map[string]bool{}
+	prev := base
+	for i := range b {
+		tip, err := repo.CommitObject(b[i].hash)
+		if err != nil {
+			return fmt.Errorf("call=CommitObject err=`%w`", err)
+		}
+		tips[i] = tip
+
+		// an empty layer has nothing to merge, layer 001 is empty when it has
+		// no commits past the merge base with trunk.
+		if tip.Hash != prev.Hash {
+			ok, err := tip.IsAncestor(trunkTip)
+			if err != nil {
+				return fmt.Errorf("call=IsAncestor err=`%w`", err)
+			}
+			b[i].Merged = ok
+			if !ok {
+				ranges[i] = prev
+				key, err := changedPaths(prev, tip)
+				if err != nil {
+					return err
+				}
+				keys[key] = true
+			}
+		}
+		prev = tip
+	}
+
+	var ids map[string]bool
+	if len(keys) > 0 {
+		ids, err = trunkPatchIDs(repo, trunkTip, base.Hash, keys)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range b {
+		if ranges[i] != nil {
+			id, err := commitRangePatchID(ranges[i], tips[i])
+			if err != nil {
+				return err
+			}
+			b[i].Merged = id != "" && ids[id]
+		}
+		if b[i].Merged {
+			b[i].Marker = markerMerged
+		}
+	}
+
+	return nil
+}
+
+// forkPoint returns the commit layer 001 started from, nil when it shares no
+// history with trunk. A tip on the first parent line of trunk is its own fork
+// point as the layer has no commits of its own, which is also how a layer that
+// was fast-forwarded into trunk looks. Otherwise it is the newest commit on the
+// first parent line of trunk that tip descends from, so a layer merged with a
+// merge commit still has commits to compare.
+func forkPoint(trunkTip, tip *object.Commit) (*object.Commit, error) {
+	bases, err := trunkTip.MergeBase(tip)
+	if err != nil {
+		return nil, fmt.Errorf("call=MergeBase err=`%w`", err)
+	}
+	if len(bases) == 0 {
+		return nil, nil
+	}
+	if bases[0].Hash != tip.Hash {
+		return bases[0], nil
+	}
+
+	c := trunkTip
+	for {
+		if c.Hash == tip.Hash {
+			return tip, nil
+		}
+
+		// commits newer than tip cannot be its ancestors, skip the walk.
+		if !c.Committer.When.After(tip.Committer.When) {
+			ok, err := c.IsAncestor(tip)
+			if err != nil {
+				return nil, fmt.Errorf("call=IsAncestor err=`%w`", err)
+			}
+			if ok {
+				return c, nil
+			}
+		}
+
+		if c.NumParents() == 0 {
+			return tip, nil
+		}
+		c, err = c.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("call=Parent err=`%w`", err)
+		}
+	}
+}
+
+// trunkPatchIDs returns the patch ID of every commit on the first parent line
+// of trunk between tip and stop that changes one of the sets of paths in keys.
+func trunkPatchIDs(repo *git.Repository, tip *object.Commit, stop plumbing.Hash, keys map[string]bool) (map[string]bool, error) {
+	var ids = map[string]bool{}
+	c := tip
+	for c.Hash != stop && c.NumParents() > 0 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("call=Parent err=`%w`", err)
+		}
+
+		if c.NumParents() == 1 {
+			key, err := changedPaths(parent, c)
+			if err != nil {
+				return nil, err
+			}
+			if keys[key] {
+				id, err := commitRangePatchID(parent, c)
+				if err != nil {
+					return nil, err
+				}
+				ids[id] = true
+			}
+		}
+		c = parent
+	}
+
+	return ids, nil
+}
+
+// changedPaths returns the sorted paths changed between from and to joined by
+// newlines. Only the trees are compared so it is far cheaper than a patch.
+func changedPaths(from, to *object.Commit) (string, error) {
+	a, err := from.Tree()
+	if err != nil {
+		return "", fmt.Errorf("call=Tree err=`%w`", err)
+	}
+
+	b, err := to.Tree()
+	if err != nil {
+		return "", fmt.Errorf("call=Tree err=`%w`", err)
+	}
+
+	changes, err := object.DiffTree(a, b)
+	if err != nil {
+		return "", fmt.Errorf("call=DiffTree err=`%w`", err)
+	}
+
+	var paths []string
+	for _, ch := range changes {
+		if ch.From.Name != "" {
+			paths = append(paths, ch.From.Name)
+		}
+		if ch.To.Name != "" && ch.To.Name != ch.From.Name {
+			paths = append(paths, ch.To.Name)
+		}
+	}
+	sort.Strings(paths)
+	return strings.Join(paths, "\n"), nil
+}
+
+func commitRangePatchID(from, to *object.Commit) (string, error) {
+	a, err := from.Tree()
+	if err != nil {
+		return "", fmt.Errorf("call=Tree err=`%w`", err)
+	}
+
+	b, err := to.Tree()
+	if err != nil {
+		return "", fmt.Errorf("call=Tree err=`%w`", err)
+	}
+
+	patch, err := a.Patch(b)
+	if err != nil {
+		return "", fmt.Errorf("call=Patch err=`%w`", err)
+	}
+
+	return patchID(patch.FilePatches()), nil
+}
+
+// patchID hashes the added and removed lines of each file ignoring whitespace
+// and line numbers, similar to git patch-id --stable. An empty patch has an
+// empty ID.
+func patchID(patches []diff.FilePatch) string {
+	var files []string
+	for _, fp := range patches {
+		var sb strings.Builder
+		from, to := fp.Files()
+		if from != nil {
+			sb.WriteString("a/" + from.Path() + "\n")
+		}
+		if to != nil {
+			sb.WriteString("b/" + to.Path() + "\n")
+		}
+
+		if fp.IsBinary() {
+			if to != nil {
+				sb.WriteString(to.Hash().String())
+			}
+			files = append(files, sb.String())
+			continue
+		}
+
+		for _, chunk := range fp.Chunks() {
+			var op string
+			switch chunk.Type() {
+			case diff.Add:
+				op = "+"
+			case diff.Delete:
+				op = "-"
+			default:
+				continue
+			}
+
+			for _, line := range strings.SplitAfter(chunk.Content(), "\n") {
+				if line == "" {
+					continue
+				}
+				sb.WriteString(op + stripSpace(line) + "\n")
+			}
+		}
+		files = append(files, sb.String())
+	}
+
+	if len(files) == 0 {
+		return ""
+	}
+
+	sort.Strings(files)
+	h := sha1.New()
+	for _, f := range files {
+		h.Write([]byte(f))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func stripSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// stackMeta is the metadata recorded by init in the [stack "<name>"] section
+// of the repository config.
+type stackMeta struct {
+	// Base is the ref layer 001 was started from and is the default target of
+	// a rebase.
+	Base string
+	// Trunk is the branch layer 001 merges into.
+	Trunk string
+	// Remote is the remote the stack is pushed to and pulled from.
+	Remote  string
+	Created time.Time
+}
+
+// readStackMeta returns the metadata for stack. Fields are empty for stacks
+// created before metadata was recorded.
+func readStackMeta(repo *git.Repository, stack string) stackMeta {
+	cfg, err := repo.Config()
+	if err != nil {
+		return stackMeta{}
+	}
+
+	s := cfg.Raw.Section("stack")
+	if !s.HasSubsection(stack) {
+		return stackMeta{}
+	}
+
+	sub := s.Subsection(stack)
+	m := stackMeta{
+		Base:   sub.Option("base"),
+		Trunk:  sub.Option("trunk"),
+		Remote: sub.Option("remote"),
+	}
+	m.Created, _ = time.Parse(time.RFC3339, sub.Option("created"))
+	return m
+}
+
+// writeStackMeta records m for stack in the repository config.
+func writeStackMeta(repo *git.Repository, stack string, m stackMeta) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("call=Config err=`%w`", err)
+	}
+
+	sub := cfg.Raw.Section("stack").Subsection(stack)
+	for _, kv := range [][2]string{
+		{"base", m.Base},
+		{"trunk", m.Trunk},
+		{"remote", m.Remote},
+		{"created", m.Created.UTC().Format(time.RFC3339)},
+	} {
+		if kv[1] == "" {
+			sub.RemoveOption(kv[0])
+			continue
+		}
+		sub.SetOption(kv[0], kv[1])
+	}
+
+	err = repo.SetConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("call=SetConfig err=`%w`", err)
+	}
+	return nil
+}
+
+// stackTrunk returns the recorded trunk of stack, otherwise main or master.
+func stackTrunk(repo *git.Repository, stack string) (string, error) {
+	if m := readStackMeta(repo, stack); m.Trunk != "" {
+		return m.Trunk, nil
+	}
+	return trunkName(repo)
+}
+
+// stackBase returns the recorded base of stack, otherwise its trunk.
+func stackBase(repo *git.Repository, stack string) (string, error) {
+	if m := readStackMeta(repo, stack); m.Base != "" {
+		return m.Base, nil
+	}
+	return stackTrunk(repo, stack)
+}
+
+// newStackMeta describes a stack started from base. A remote-tracking base
+// such as origin/main records main as the trunk, a local branch records itself
+// as the trunk and any other base falls back to main or master. No remote is
+// recorded as the upstream of the trunk is not necessarily where the stack is
+// pushed, git stack remote records one explicitly.
+func newStackMeta(repo *git.Repository, base string) stackMeta {
+	m := stackMeta{Base: base, Created: time.Now()}
+
+	if _, err := repo.Reference(plumbing.NewBranchReferenceName(base), false); err == nil {
+		m.Trunk = base
+		return m
+	}
+
+	if remote, branch, ok := strings.Cut(base, "/"); ok {
+		_, err := repo.Reference(plumbing.NewRemoteReferenceName(remote, branch), false)
+		if err == nil {
+			m.Trunk = branch
+			return m
+		}
+	}
+
+	m.Trunk, _ = trunkName(repo)
+	return m
+}
+
+// removeStackMeta removes the metadata recorded for stack.
+func removeStackMeta(repo *git.Repository, stack string) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("call=Config err=`%w`", err)
+	}
+
+	cfg.Raw.Section("stack").RemoveSubsection(stack)
+	err = repo.SetConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("call=SetConfig err=`%w`", err)
+	}
+	return nil
+}
+
+// moveStackMeta moves the metadata recorded for stack to name.
+func moveStackMeta(repo *git.Repository, stack, name string) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("call=Config err=`%w`", err)
+	}
+
+	s := cfg.Raw.Section("stack")
+	s.RemoveSubsection(name)
+	if !s.HasSubsection(stack) {
+		return nil
+	}
+
+	sub := s.Subsection(name)
+	sub.Options = s.Subsection(stack).Options
+	s.RemoveSubsection(stack)
+
+	err = repo.SetConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("call=SetConfig err=`%w`", err)
+	}
+	return nil
+}
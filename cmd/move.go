@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"slices"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Move places a layer at another position in the current stack. Each layer's
+// own commits are replayed in the new order and the branches renamed to match
+// their new sequence. On a conflict every branch is restored.
+func Move(input Flags, w io.Writer) int {
+	if input.Name == "" || input.To == 0 {
+		log.Printf("call=Move err=`layer and --to position must be specified`\n")
+		return ErrMissingArguments
+	}
+
+	repo, wt, err := openWorkTree()
+	if err != nil {
+		log.Printf("call=openWorkTree err=`%v`\n", err)
+		return ErrNotRepository
+	}
+
+	parts, err := headParts(repo)
+	if err != nil {
+		log.Printf("call=headParts err=`%v`\n", err)
+		return ErrHead
+	}
+
+	if !isStack(parts) {
+		log.Printf("call=Split err=`want 4 parts, got %d`\n", len(parts))
+		return ErrInvalidStack
+	}
+
+	stack := parts[stackName]
+	layers, err := stackLayers(repo, stack)
+	if err != nil {
+		log.Printf("call=stackLayers err=`%v`\n", err)
+		return ErrUnknownBranch
+	}
+
+	target, code := findLayer(layers, input.Name, w)
+	if code != Success {
+		return code
+	}
+	from := slices.Index(layers, target)
+
+	to := input.To - 1
+	if to < 0 || to >= len(layers) {
+		log.Printf("call=Move err=`position %d outside of 1..%d`\n", input.To, len(layers))
+		return ErrInvalidArgument
+	}
+	if to == from {
+		fmt.Fprintf(w, "%s is already at position %d\n", layers[from], input.To)
+		return Success
+	}
+
+	trunk, err := stackTrunk(repo, stack)
+	if err != nil {
+		log.Printf("call=stackTrunk err=`%v`\n", err)
+		return ErrUnknownBranch
+	}
+
+	base, err := mergeBase(repo, trunk, layers[0])
+	if err != nil {
+		log.Printf("call=mergeBase err=`%v`\n", err)
+		return ErrUnknownBranch
+	}
+
+	// parent maps each layer to the original tip below it so only its own
+	// commits are replayed.
+	var tips = map[string]plumbing.Hash{}
+	var parent = map[string]plumbing.Hash{}
+	prev := base
+	for _, l := range layers {
+		ref, err := repo.Reference(plumbing.NewBranchReferenceName(l), true)
+		if err != nil {
+			log.Printf("call=Reference err=`%v`\n", err)
+			return ErrUnknownBranch
+		}
+		tips[l] = ref.Hash()
+		parent[l] = prev
+		prev = ref.Hash()
+	}
+
+	order := slices.Delete(slices.Clone(layers), from, from+1)
+	order = slices.Insert(order, to, layers[from])
+
+	// the sequence numbers stay in place and the layers move between them.
+	var renames []rename
+	for i, l := range order {
+		n := layerName(stack, layerSeq(layers[i]), layerDesc(l))
+		if n != l {
+			renames = append(renames, rename{old: l, new: n})
+		}
+	}
+
+	renames, err = renameOrder(renames)
+	if err != nil {
+		log.Printf("call=renameOrder err=`%v`\n", err)
+		return ErrInvalidArgument
+	}
+
+	current := stack + "/" + parts[stackBranch]
+	onto := base.String()
+	for _, l := range order {
+		_, err = gitCmd(wt, "rebase", "--onto", onto, parent[l].String(), l)
+		if err != nil {
+			log.Printf("call=gitCmd err=`%v`\n", err)
+			gitCmd(wt, "rebase", "--abort")
+			restoreTips(repo, tips)
+			gitCmd(wt, "checkout", current)
+			fmt.Fprintf(w, "Unable to move %s, replaying %s conflicts, the stack is unchanged\n", layers[from], l)
+			return ErrRebasing
+		}
+
+		ref, err := repo.Reference(plumbing.NewBranchReferenceName(l), true)
+		if err != nil {
+			log.Printf("call=Reference err=`%v`\n", err)
+			return ErrUnknownBranch
+		}
+		onto = ref.Hash().String()
+	}
+
+	_, err = gitCmd(wt, "checkout", current)
+	if err != nil {
+		log.Printf("call=gitCmd err=`%v`\n", err)
+		return ErrUnknownBranch
+	}
+
+	err = renameBranches(repo, stack, renames, w)
+	if err != nil {
+		log.Printf("call=renameBranches err=`%v`\n", err)
+		restoreTips(repo, tips)
+		return ErrCreatingBranch
+	}
+
+	return Success
+}
+
+// restoreTips points every branch back at its original commit.
+func restoreTips(repo *git.Repository, tips map[string]plumbing.Hash) {
+	for l, h := range tips {
+		err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(l), h))
+		if err != nil {
+			log.Printf("call=SetReference branch=%s err=`%v`\n", l, err)
+		}
+	}
+}
+
+// renameOrder orders renames so no branch is renamed onto a name that has
+// yet to be renamed away.
+func renameOrder(renames []rename) ([]rename, error) {
+	var ordered []rename
+	for len(renames) > 0 {
+		i := slices.IndexFunc(renames, func(r rename) bool {
+			return !slices.ContainsFunc(renames, func(o rename) bool {
+				return o.old == r.new
+			})
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("layers with the same name cannot swap places")
+		}
+		ordered = append(ordered, renames[i])
+		renames = slices.Delete(renames, i, i+1)
+	}
+	return ordered, nil
+}
@@ -0,0 +1,92 @@
+package cmd_test
+
+import (
+	"bytes"
+	"github.com/nfisher/gitit/assert"
+	. "github.com/nfisher/gitit/cmd"
+	"io"
+	"testing"
+)
+
+func Test_move_returns_missing_arguments_without_position(t *testing.T) {
+	i := Exec(Flags{SubCommand: "move", Name: "003"}, io.Discard)
+	assert.Int(t, i).Equals(ErrMissingArguments)
+}
+
+func Test_move_rejects_position_outside_stack(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	CreateThreeLayerStack(t, repo)
+
+	i := Exec(Flags{SubCommand: "move", Name: "003", To: 4}, io.Discard)
+	assert.Int(t, i).Equals(ErrInvalidArgument)
+}
+
+func Test_move_unknown_layer_fails(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	CreateThreeLayerStack(t, repo)
+
+	i := Exec(Flags{SubCommand: "move", Name: "004", To: 1}, io.Discard)
+	assert.Int(t, i).Equals(ErrUnknownBranch)
+}
+
+func Test_move_reorders_layers(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	CreateThreeLayerStack(t, repo)
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "move", Name: "003", To: 1}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`Renamed branch kb1234/003_ui to kb1234/001_ui
+Renamed branch kb1234/001_docs to kb1234/002_docs
+Renamed branch kb1234/002_api to kb1234/003_api
+`)
+
+	repo = Reopen(t, repo)
+	assert.Repo(t, repo).Branch("kb1234/001_ui")
+	assert.Repo(t, repo).Parent("kb1234/001_ui", "master")
+	assert.Repo(t, repo).IsAncestor("kb1234/001_ui", "kb1234/002_docs")
+	assert.Repo(t, repo).Parent("kb1234/003_api", "kb1234/002_docs")
+	assert.Repo(t, repo).Message("kb1234/001_ui", "Add ui.js")
+	assert.Repo(t, repo).Message("kb1234/003_api", "Add api.js")
+	assert.Repo(t, repo).ExcludesBranches("kb1234/001_docs", "kb1234/002_api", "kb1234/003_ui")
+}
+
+func Test_move_with_conflict_leaves_stack_unchanged(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	CreateThreeLayerStack(t, repo)
+	Commit(t, WorkTree(t, repo), map[string]string{"api.js": "function api() { return 1 }"}, "Update api.js")
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "move", Name: "003", To: 1}, &buf)
+	assert.Int(t, i).Equals(ErrRebasing)
+	assert.String(t, buf.String()).Equals("Unable to move kb1234/003_ui, replaying kb1234/003_ui conflicts, the stack is unchanged\n")
+
+	repo = Reopen(t, repo)
+	assert.Repo(t, repo).Branch("kb1234/003_ui")
+	assert.Repo(t, repo).Message("kb1234/003_ui", "Update api.js")
+	assert.Repo(t, repo).Parent("kb1234/002_api", "kb1234/001_docs")
+	assert.Repo(t, repo).IsAncestor("kb1234/002_api", "kb1234/003_ui")
+}
+
+func Test_move_same_names_leaves_history_unchanged(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	wt := WorkTree(t, repo)
+	InitialCommit(t, repo)
+	InitStack(t, repo, "kb1234", "001_fix")
+	Commit(t, wt, map[string]string{"a.txt": "a"}, "Add a.txt")
+	CreateBranch(t, repo, "kb1234", "002_fix")
+	Commit(t, wt, map[string]string{"b.txt": "b"}, "Add b.txt")
+
+	i := Exec(Flags{SubCommand: "move", Name: "002", To: 1}, io.Discard)
+	assert.Int(t, i).Equals(ErrInvalidArgument)
+
+	repo = Reopen(t, repo)
+	assert.Repo(t, repo).Branch("kb1234/002_fix")
+	assert.Repo(t, repo).Parent("kb1234/002_fix", "kb1234/001_fix")
+	assert.Repo(t, repo).Parent("kb1234/001_fix", "master")
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"slices"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// Navigate checks out the layer above (next), below (prev), the first
+// (bottom) or the last (top) layer relative to the current one.
+func Navigate(input Flags, w io.Writer) int {
+	repo, wt, err := openWorkTree()
+	if err != nil {
+		log.Printf("call=openWorkTree err=`%v`\n", err)
+		return ErrNotRepository
+	}
+
+	parts, err := headParts(repo)
+	if err != nil {
+		log.Printf("call=headParts err=`%v`\n", err)
+		return ErrHead
+	}
+
+	if !isStack(parts) {
+		log.Printf("call=Split err=`want 4 parts, got %d`\n", len(parts))
+		return ErrInvalidStack
+	}
+
+	layers, err := stackLayers(repo, parts[stackName])
+	if err != nil {
+		log.Printf("call=stackLayers err=`%v`\n", err)
+		return ErrUnknownBranch
+	}
+
+	i := slices.Index(layers, parts[stackName]+"/"+parts[stackBranch])
+	switch input.SubCommand {
+	case "next":
+		i++
+	case "prev":
+		i--
+	case "bottom":
+		i = 0
+	case "top":
+		i = len(layers) - 1
+	}
+
+	if i < 0 {
+		fmt.Fprintln(w, "Already on the bottom layer")
+		return ErrUnknownBranch
+	}
+	if i >= len(layers) {
+		fmt.Fprintln(w, "Already on the top layer")
+		return ErrUnknownBranch
+	}
+
+	err = checkoutLayer(wt, layers[i])
+	if err != nil {
+		log.Printf("call=checkoutLayer err=`%v`\n", err)
+		return ErrUnknownBranch
+	}
+
+	fmt.Fprintln(w, "Switched to branch", layers[i])
+	return Success
+}
+
+// checkoutLayer switches to the layer branch. Local changes are carried
+// across and the checkout is refused when they would be overwritten.
+func checkoutLayer(wt *git.Worktree, layer string) error {
+	_, err := gitCmd(wt, "checkout", layer)
+	if err != nil {
+		return fmt.Errorf("call=gitCmd branch=%s err=`%w`", layer, err)
+	}
+	return nil
+}
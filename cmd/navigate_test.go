@@ -0,0 +1,75 @@
+package cmd_test
+
+import (
+	"bytes"
+	"github.com/nfisher/gitit/assert"
+	. "github.com/nfisher/gitit/cmd"
+	"io"
+	"testing"
+)
+
+func Test_navigate_outside_stack_fails(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	InitialCommit(t, repo)
+
+	i := Exec(Flags{SubCommand: "next"}, io.Discard)
+	assert.Int(t, i).Equals(ErrInvalidStack)
+}
+
+func Test_navigate_moves_between_layers(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	CreateThreeLayerStack(t, repo)
+
+	td := []struct {
+		cmd  string
+		want string
+	}{
+		{"bottom", "kb1234/001_docs"},
+		{"next", "kb1234/002_api"},
+		{"next", "kb1234/003_ui"},
+		{"prev", "kb1234/002_api"},
+		{"top", "kb1234/003_ui"},
+	}
+
+	for _, tc := range td {
+		var buf bytes.Buffer
+		i := Exec(Flags{SubCommand: tc.cmd}, &buf)
+		assert.Int(t, i).Equals(Success)
+		assert.String(t, buf.String()).Equals("Switched to branch " + tc.want + "\n")
+		assert.Repo(t, repo).Branch(tc.want)
+	}
+}
+
+func Test_navigate_past_the_ends_fails(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	CreateThreeLayerStack(t, repo)
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "next"}, &buf)
+	assert.Int(t, i).Equals(ErrUnknownBranch)
+	assert.String(t, buf.String()).Equals("Already on the top layer\n")
+
+	i = Exec(Flags{SubCommand: "bottom"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	buf.Reset()
+	i = Exec(Flags{SubCommand: "prev"}, &buf)
+	assert.Int(t, i).Equals(ErrUnknownBranch)
+	assert.String(t, buf.String()).Equals("Already on the bottom layer\n")
+	assert.Repo(t, repo).Branch("kb1234/001_docs")
+}
+
+func Test_navigate_keeps_local_changes(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	CreateThreeLayerStack(t, repo)
+	CreateFile(t, "notes.txt", "todo")
+
+	i := Exec(Flags{SubCommand: "prev"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assert.Repo(t, repo).Branch("kb1234/002_api")
+	assert.Exists(t, "notes.txt")
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// syncPullRequests opens a pull request for every unmerged layer in the stack
+// that does not have one. The lowest unmerged layer targets the trunk and every
+// other layer targets the unmerged layer below it. Existing pull requests are retargeted and their
+// title and body refreshed when the stack has changed. When dryRun is set the
+// changes are written to w but not applied.
+func syncPullRequests(repo *git.Repository, remote *git.Remote, stack string, dryRun bool, w io.Writer) error {
+	svc, err := NewPullRequestService(repo, remote)
+	if err != nil {
+		return fmt.Errorf("call=NewPullRequestService err=`%w`", err)
+	}
+
+	if svc == nil {
+		return nil
+	}
+
+	trunk, err := stackTrunk(repo, stack)
+	if err != nil {
+		return fmt.Errorf("call=stackTrunk err=`%w`", err)
+	}
+
+	layers, err := stackLayers(repo, stack)
+	if err != nil {
+		return fmt.Errorf("call=stackLayers err=`%w`", err)
+	}
+
+	prs, err := svc.List(stack)
+	if err != nil {
+		return fmt.Errorf("call=List err=`%w`", err)
+	}
+
+	var existing = map[string]PullRequest{}
+	for _, pr := range prs {
+		existing[pr.Head] = pr
+	}
+
+	b, err := layerBranches(repo, layers)
+	if err != nil {
+		return err
+	}
+
+	err = markMerged(repo, trunk, b)
+	if err != nil {
+		log.Printf("call=markMerged err=`%v`\n", err)
+	}
+
+	// merged layers no longer need a pull request, the layer above them
+	// targets the next unmerged layer below it or the trunk.
+	prev := trunk
+	for i, l := range layers {
+		if b[i].Merged {
+			continue
+		}
+		base := prev
+		prev = l
+
+		want := PullRequest{
+			Title: prTitle(layers, i),
+			Body:  prBody(layers, i),
+			Head:  l,
+			Base:  base,
+		}
+
+		pr, ok := existing[l]
+		if !ok && dryRun {
+			fmt.Fprintf(w, "Would create pull request %q for %s\n", want.Title, l)
+			continue
+		} else if !ok {
+			pr, err = svc.Create(want)
+			if err != nil {
+				return fmt.Errorf("call=Create head=%s err=`%w`", l, err)
+			}
+			fmt.Fprintf(w, "Created pull request %s for %s\n", pr.URL, l)
+			continue
+		}
+
+		if pr.Title == want.Title && pr.Body == want.Body && pr.Base == want.Base {
+			continue
+		}
+
+		if dryRun {
+			fmt.Fprintf(w, "Would update pull request %s for %s\n", pr.URL, l)
+			continue
+		}
+
+		want.Number = pr.Number
+		pr, err = svc.Update(want)
+		if err != nil {
+			return fmt.Errorf("call=Update head=%s err=`%w`", l, err)
+		}
+		fmt.Fprintf(w, "Updated pull request %s for %s\n", pr.URL, l)
+	}
+
+	for _, pr := range prs {
+		if slices.Contains(layers, pr.Head) {
+			continue
+		}
+		fmt.Fprintf(w, "Pull request %s for %s is no longer in the stack\n", pr.URL, pr.Head)
+	}
+
+	return nil
+}
+
+// prTitle returns a title such as "[kb1234 2/3] api" for the layer at i.
+func prTitle(layers []string, i int) string {
+	p := strings.SplitN(layers[i], "/", 2)
+	desc := strings.ReplaceAll(p[1][strings.Index(p[1], "_")+1:], "_", " ")
+	return fmt.Sprintf("[%s %d/%d] %s", p[0], i+1, len(layers), desc)
+}
+
+// prBody lists the layers of the stack highlighting the layer at i.
+func prBody(layers []string, i int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Stack %s:\n\n", strings.SplitN(layers[i], "/", 2)[0])
+	for j, l := range layers {
+		if i == j {
+			fmt.Fprintf(&b, "* **%s** (this pull request)\n", l)
+		} else {
+			fmt.Fprintf(&b, "* %s\n", l)
+		}
+	}
+	return b.String()
+}
+
+const (
+	markerMerged = "🚢"
+	markerOpen   = "✅"
+	markerFailed = "❌"
+)
+
+// prMarker summarises a pull request as merged, open or failing/closed.
+func prMarker(pr PullRequest) string {
+	switch {
+	case pr.Merged:
+		return markerMerged
+	case pr.State != "open" || pr.Failing:
+		return markerFailed
+	default:
+		return markerOpen
+	}
+}
+
+// annotatePullRequests sets the marker and URL of every branch in the stack
+// that has a pull request.
+func annotatePullRequests(repo *git.Repository, remote *git.Remote, stack string, b branches) error {
+	svc, err := NewPullRequestService(repo, remote)
+	if err != nil {
+		return fmt.Errorf("call=NewPullRequestService err=`%w`", err)
+	}
+
+	if svc == nil {
+		return nil
+	}
+
+	for i := range b {
+		pr, err := svc.Lookup(stack + "/" + b[i].Name)
+		if err != nil {
+			return fmt.Errorf("call=Lookup err=`%w`", err)
+		}
+
+		if pr == nil {
+			continue
+		}
+
+		b[i].Marker = prMarker(*pr)
+		b[i].URL = pr.URL
+		b[i].prState = pullRequestState(*pr)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Pull fetches the current stack from the remote. Local branches that are
+// strictly behind are fast-forwarded, branches missing locally are created
+// and branches that have diverged are reported and left untouched.
+func Pull(input Flags, w io.Writer) int {
+	repo, wt, err := openWorkTree()
+	if err != nil {
+		log.Printf("call=openWorkTree err=`%v`\n", err)
+		return ErrNotRepository
+	}
+
+	parts, err := headParts(repo)
+	if err != nil {
+		log.Printf("call=headParts err=`%v`\n", err)
+		return ErrHead
+	}
+
+	if !isStack(parts) {
+		log.Printf("call=Split err=`want 4 parts, got %d`\n", len(parts))
+		return ErrInvalidStack
+	}
+
+	remote, err := selectRemote(repo, input.Remote, parts[stackName])
+	if err == errNoRemote {
+		log.Printf("call=selectRemote err=`%v`\n", err)
+		return ErrInvalidStack
+	} else if err != nil {
+		log.Printf("call=selectRemote err=`%v`\n", err)
+		return ErrInvalidArgument
+	}
+
+	remoteName := remote.Config().Name
+	stack := parts[stackName]
+	err = fetchStack(repo, remote, stack)
+	if err != nil {
+		log.Printf("call=fetchStack err=`%v`\n", err)
+		return ErrPullingStack
+	}
+
+	remoteRefs, err := trackingRefs(repo, remoteName, stack)
+	if err != nil {
+		log.Printf("call=trackingRefs err=`%v`\n", err)
+		return ErrPullingStack
+	}
+
+	prefix := trackingPrefix(remoteName, stack)
+	current := stack + "/" + parts[stackBranch]
+	var code = Success
+	for _, r := range remoteRefs {
+		name := stack + "/" + strings.TrimPrefix(r.Name().String(), prefix)
+		branchRef := plumbing.NewBranchReferenceName(name)
+		local, err := repo.Reference(branchRef, true)
+		if err == plumbing.ErrReferenceNotFound {
+			err = repo.Storer.SetReference(plumbing.NewHashReference(branchRef, r.Hash()))
+			if err != nil {
+				log.Printf("call=SetReference err=`%v`\n", err)
+				return ErrPullingStack
+			}
+			fmt.Fprintf(w, "Created %s\n", name)
+			continue
+		} else if err != nil {
+			log.Printf("call=Reference err=`%v`\n", err)
+			return ErrPullingStack
+		}
+
+		switch remoteState(repo, local.Hash(), r.Hash().String()).State {
+		case stateSame:
+			continue
+
+		case stateAhead:
+			fmt.Fprintf(w, "Skipped %s, ahead of %s\n", name, remoteName)
+			continue
+
+		case stateDiverged:
+			fmt.Fprintf(w, "Skipped %s, diverged from %s\n", name, remoteName)
+			code = ErrDiverged
+			continue
+		}
+
+		if name == current {
+			_, err = gitCmd(wt, "merge", "--ff-only", r.Name().String())
+		} else {
+			err = repo.Storer.SetReference(plumbing.NewHashReference(branchRef, r.Hash()))
+		}
+		if err != nil {
+			log.Printf("call=fastForward branch=%s err=`%v`\n", name, err)
+			return ErrPullingStack
+		}
+		fmt.Fprintf(w, "Fast-forwarded %s\n", name)
+	}
+
+	return code
+}
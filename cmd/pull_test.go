@@ -0,0 +1,108 @@
+package cmd_test
+
+import (
+	"bytes"
+	"github.com/nfisher/gitit/assert"
+	. "github.com/nfisher/gitit/cmd"
+	"io"
+	"testing"
+)
+
+func Test_pull_on_invalid_stack_fails(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	InitialCommit(t, repo)
+
+	i := Exec(Flags{SubCommand: "pull"}, io.Discard)
+	assert.Int(t, i).Equals(ErrInvalidStack)
+}
+
+func Test_pull_fast_forwards_layers_behind_remote(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo1, r1close := CreateRepo(t)
+	defer r1close()
+
+	wt1 := WorkTree(t, repo1)
+	CreateThreeLayerStack(t, repo1)
+	CreateRemote(t, repo1, server)
+	PushBranch(t, repo1, "kb1234/001_docs")
+	PushBranch(t, repo1, "kb1234/002_api")
+
+	repo2, r2close := CloneRepo(t, server, "kb1234/001_docs")
+	defer r2close()
+	FetchRefs(t, repo2, "kb1234/*")
+
+	Chdir(t, wt1)
+	CheckoutBranch(t, wt1, "kb1234/001_docs")
+	Commit(t, wt1, map[string]string{"README.md": "Hello world!"}, "Update README.md")
+	PushBranch(t, repo1, "kb1234/001_docs")
+	PushBranch(t, repo1, "kb1234/003_ui")
+
+	Chdir(t, WorkTree(t, repo2))
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "pull"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`Fast-forwarded kb1234/001_docs
+Created kb1234/003_ui
+`)
+	repo2 = Reopen(t, repo2)
+	assert.Repo(t, repo2).Branch("kb1234/001_docs")
+	assert.Repo(t, repo2).Message("kb1234/001_docs", "Update README.md")
+	assert.Repo(t, repo2).IsAncestor("kb1234/002_api", "kb1234/003_ui")
+}
+
+func Test_pull_reports_diverged_layers(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo1, r1close := CreateRepo(t)
+	defer r1close()
+
+	wt1 := WorkTree(t, repo1)
+	CreateThreeLayerStack(t, repo1)
+	CreateRemote(t, repo1, server)
+	PushBranch(t, repo1, "kb1234/001_docs")
+	PushBranch(t, repo1, "kb1234/002_api")
+	PushBranch(t, repo1, "kb1234/003_ui")
+
+	repo2, r2close := CloneRepo(t, server, "kb1234/003_ui")
+	defer r2close()
+	FetchRefs(t, repo2, "kb1234/*")
+	wt2 := WorkTree(t, repo2)
+	Commit(t, wt2, map[string]string{"ui.js": "function ui() { return false; }"}, "Update ui.js")
+
+	Chdir(t, wt1)
+	Commit(t, wt1, map[string]string{"ui.js": "function ui() { return true; }"}, "Update ui.js")
+	PushBranch(t, repo1, "kb1234/003_ui")
+
+	Chdir(t, wt2)
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "pull"}, &buf)
+	assert.Int(t, i).Equals(ErrDiverged)
+	assert.String(t, buf.String()).Equals(`Skipped kb1234/003_ui, diverged from origin
+`)
+	assert.Repo(t, repo2).Message("kb1234/003_ui", "Update ui.js")
+}
+
+func Test_pull_from_empty_remote_succeeds(t *testing.T) {
+	origin, originclose := LaunchServer(t)
+	defer originclose()
+
+	fork, forkclose := LaunchServer(t)
+	defer forkclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, origin)
+	CreateNamedRemote(t, repo, "fork", fork)
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "pull", Remote: "fork"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals("")
+}
@@ -1,9 +1,11 @@
 package cmd_test
 
 import (
+	"bytes"
 	"github.com/nfisher/gitit/assert"
 	. "github.com/nfisher/gitit/cmd"
 	"io"
+	"strings"
 	"testing"
 )
 
@@ -16,6 +18,7 @@ func Test_push_returns_success(t *testing.T) {
 
 	CreateThreeLayerStack(t, repo)
 	CreateRemote(t, repo, server)
+	t.Setenv("GITHUB_TOKEN", "")
 
 	i := Exec(Flags{SubCommand: "push"}, io.Discard)
 	assert.Int(t, i).Equals(Success)
@@ -26,3 +29,197 @@ func Test_push_returns_success(t *testing.T) {
 	assert.Remote(t, server.Address()).ExcludesBranches(
 		"kb3456/001_migration")
 }
+
+func Test_push_opens_pull_request_per_layer(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+
+	gh, ghclose := LaunchGitHub(t, repo)
+	defer ghclose()
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	i = Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, strings.Join(gh.Bases(), "\n")).Equals(`kb1234/001_docs:master
+kb1234/002_api:kb1234/001_docs
+kb1234/003_ui:kb1234/002_api`)
+	assert.String(t, gh.Pulls[1].Title).Equals("[kb1234 2/3] api")
+}
+
+func Test_push_retargets_pull_requests_when_layer_removed(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+
+	gh, ghclose := LaunchGitHub(t, repo)
+	defer ghclose()
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	DeleteBranch(t, repo, "kb1234/002_api")
+
+	var buf bytes.Buffer
+	i = Exec(Flags{SubCommand: "push"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, strings.Join(gh.Bases(), "\n")).Equals(`kb1234/001_docs:master
+kb1234/002_api:kb1234/001_docs
+kb1234/003_ui:kb1234/001_docs`)
+	assert.String(t, gh.Pulls[2].Title).Equals("[kb1234 2/2] ui")
+	assert.String(t, gh.Pulls[0].Body).Equals(`Stack kb1234:
+
+* **kb1234/001_docs** (this pull request)
+* kb1234/003_ui
+`)
+	assert.String(t, buf.String()).Equals(`Updated pull request https://github.com/nfisher/gitit/pull/1 for kb1234/001_docs
+Updated pull request https://github.com/nfisher/gitit/pull/3 for kb1234/003_ui
+Pull request https://github.com/nfisher/gitit/pull/2 for kb1234/002_api is no longer in the stack
+`)
+}
+
+func Test_push_skips_merged_layers(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+
+	gh, ghclose := LaunchGitHub(t, repo)
+	defer ghclose()
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	for _, args := range [][]string{
+		{"checkout", "master"},
+		{"merge", "--no-ff", "-m", "Merge kb1234/001_docs", "kb1234/001_docs"},
+		{"checkout", "kb1234/003_ui"},
+	} {
+		out, err := GitCmd(t, args...)
+		if err != nil {
+			t.Fatalf("call=GitCmd err=`%v` output=`%s`", err, out)
+		}
+	}
+	gh.Pulls[0].State = "closed"
+
+	var buf bytes.Buffer
+	i = Exec(Flags{SubCommand: "push"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, strings.Join(gh.Bases(), "\n")).Equals(`kb1234/001_docs:master
+kb1234/002_api:master
+kb1234/003_ui:kb1234/002_api`)
+	assert.String(t, buf.String()).Equals(`Updated pull request https://github.com/nfisher/gitit/pull/2 for kb1234/002_api
+`)
+}
+
+func Test_push_after_move_renames_remote_branches(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+
+	gh, ghclose := LaunchGitHub(t, repo)
+	defer ghclose()
+	gh.Git = server
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	i = Exec(Flags{SubCommand: "move", Name: "003", To: 1}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	var buf bytes.Buffer
+	i = Exec(Flags{SubCommand: "push"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, strings.Join(gh.Bases(), "\n")).Equals(`kb1234/002_docs:kb1234/001_ui
+kb1234/003_api:kb1234/002_docs
+kb1234/001_ui:master`)
+	assert.String(t, buf.String()).Equals(`Renamed kb1234/003_ui to kb1234/001_ui on origin
+Renamed kb1234/001_docs to kb1234/002_docs on origin
+Renamed kb1234/002_api to kb1234/003_api on origin
+Updated pull request https://github.com/nfisher/gitit/pull/3 for kb1234/001_ui
+Updated pull request https://github.com/nfisher/gitit/pull/1 for kb1234/002_docs
+Updated pull request https://github.com/nfisher/gitit/pull/2 for kb1234/003_api
+`)
+	assert.Remote(t, server.Address()).IncludesBranches(
+		"kb1234/001_ui",
+		"kb1234/002_docs",
+		"kb1234/003_api")
+	assert.Remote(t, server.Address()).ExcludesBranches(
+		"kb1234/001_docs",
+		"kb1234/002_api",
+		"kb1234/003_ui")
+}
+
+func Test_push_dry_run_changes_nothing(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+	PushBranch(t, repo, "master")
+
+	gh, ghclose := LaunchGitHub(t, repo)
+	defer ghclose()
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "push", DryRun: true}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`Would push kb1234/001_docs a4f8278 to origin
+Would push kb1234/002_api e8decd8 to origin
+Would push kb1234/003_ui cd73600 to origin
+Would create pull request "[kb1234 1/3] docs" for kb1234/001_docs
+Would create pull request "[kb1234 2/3] api" for kb1234/002_api
+Would create pull request "[kb1234 3/3] ui" for kb1234/003_ui
+`)
+	assert.Remote(t, server.Address()).ExcludesBranches(
+		"kb1234/001_docs",
+		"kb1234/002_api",
+		"kb1234/003_ui")
+	assert.Int(t, len(gh.Pulls)).Equals(0)
+}
+
+func Test_push_targets_recorded_trunk(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+	out, err := GitCmd(t, "config", "stack.kb1234.trunk", "develop")
+	if err != nil {
+		t.Fatalf("call=GitCmd err=`%v` output=`%s`", err, out)
+	}
+
+	gh, ghclose := LaunchGitHub(t, repo)
+	defer ghclose()
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, gh.Bases()[0]).Equals("kb1234/001_docs:develop")
+}
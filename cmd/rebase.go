@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Rebase restacks every layer of the current stack. Layer 001 is replayed onto
+// the given trunk, otherwise the base recorded by init, and each following
+// layer is replayed onto the new tip of the layer below it. On a conflict every
+// layer is restored to its original commit.
+func Rebase(input Flags, w io.Writer) int {
+	repo, wt, err := openWorkTree()
+	if err != nil {
+		log.Printf("call=openWorkTree err=`%v`\n", err)
+		return ErrNotRepository
+	}
+
+	parts, err := headParts(repo)
+	if err != nil {
+		log.Printf("call=headParts err=`%v`\n", err)
+		return ErrHead
+	}
+
+	if !isStack(parts) {
+		log.Printf("call=Split err=`want 4 parts, got %d`\n", len(parts))
+		return ErrInvalidStack
+	}
+
+	trunk := input.Name
+	if trunk == "" {
+		trunk, err = stackBase(repo, parts[stackName])
+		if err != nil {
+			log.Printf("call=stackBase err=`%v`\n", err)
+			return ErrUnknownBranch
+		}
+	}
+
+	layers, err := stackLayers(repo, parts[stackName])
+	if err != nil {
+		log.Printf("call=stackLayers err=`%v`\n", err)
+		return ErrUnknownBranch
+	}
+
+	// capture the original tips so each layer only replays its own commits and
+	// every layer can be restored when one of them conflicts.
+	var tips []plumbing.Hash
+	var original = map[string]plumbing.Hash{}
+	for _, l := range layers {
+		ref, err := repo.Reference(plumbing.NewBranchReferenceName(l), true)
+		if err != nil {
+			log.Printf("call=Reference err=`%v`\n", err)
+			return ErrUnknownBranch
+		}
+		tips = append(tips, ref.Hash())
+		original[l] = ref.Hash()
+	}
+
+	current := parts[stackName] + "/" + parts[stackBranch]
+	for i, l := range layers {
+		var args []string
+		onto := trunk
+		if i == 0 {
+			args = []string{"rebase", trunk, l}
+		} else {
+			onto = layers[i-1]
+			args = []string{"rebase", "--onto", onto, tips[i-1].String(), l}
+		}
+
+		_, err = gitCmd(wt, args...)
+		if err != nil {
+			log.Printf("call=gitCmd err=`%v`\n", err)
+			gitCmd(wt, "rebase", "--abort")
+			restoreTips(repo, original)
+			gitCmd(wt, "checkout", current)
+			fmt.Fprintf(w, "Unable to rebase %s onto %s, the stack is unchanged\n", l, onto)
+			return ErrRebasing
+		}
+		fmt.Fprintf(w, "Rebased %s onto %s\n", l, onto)
+	}
+
+	_, err = gitCmd(wt, "checkout", current)
+	if err != nil {
+		log.Printf("call=gitCmd err=`%v`\n", err)
+		return ErrUnknownBranch
+	}
+
+	return Success
+}
@@ -0,0 +1,185 @@
+package cmd_test
+
+import (
+	"bytes"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/nfisher/gitit/assert"
+	. "github.com/nfisher/gitit/cmd"
+	"io"
+	"testing"
+)
+
+func Test_rebase_outside_repo_should_fail(t *testing.T) {
+	tdclose := CreateBareDir(t)
+	defer tdclose()
+
+	i := Exec(Flags{SubCommand: "rebase"}, io.Discard)
+	assert.Int(t, i).Equals(ErrNotRepository)
+}
+
+func Test_rebase_on_invalid_stack_fails(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	InitialCommit(t, repo)
+
+	i := Exec(Flags{SubCommand: "rebase"}, io.Discard)
+	assert.Int(t, i).Equals(ErrInvalidStack)
+	assert.Repo(t, repo).Branch("master")
+}
+
+func Test_rebase_restacks_all_layers_onto_trunk(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	wt := WorkTree(t, repo)
+	CheckoutBranch(t, wt, "master")
+	Commit(t, wt, map[string]string{"LICENSE": "MIT"}, "Add LICENSE")
+	CheckoutBranch(t, wt, "kb1234/002_api")
+
+	i := Exec(Flags{SubCommand: "rebase"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assert.Repo(t, repo).Branch("kb1234/002_api")
+	assert.Repo(t, repo).IsAncestor("master", "kb1234/001_docs")
+	assert.Repo(t, repo).IsAncestor("kb1234/001_docs", "kb1234/002_api")
+	assert.Repo(t, repo).IsAncestor("kb1234/002_api", "kb1234/003_ui")
+}
+
+func Test_rebase_with_conflict_fails(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	wt := WorkTree(t, repo)
+	CheckoutBranch(t, wt, "master")
+	Commit(t, wt, map[string]string{"README.md": "Goodbye world"}, "Add README.md")
+	CheckoutBranch(t, wt, "kb1234/003_ui")
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "rebase"}, &buf)
+	assert.Int(t, i).Equals(ErrRebasing)
+	assert.Repo(t, repo).Branch("kb1234/003_ui")
+	assert.String(t, buf.String()).Equals("Unable to rebase kb1234/001_docs onto master, the stack is unchanged\n")
+}
+
+func Test_rebase_with_conflict_in_higher_layer_restores_lower_layers(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	wt := WorkTree(t, repo)
+	CheckoutBranch(t, wt, "master")
+	Commit(t, wt, map[string]string{"api.js": "function api(v) {}"}, "Add api.js")
+	CheckoutBranch(t, wt, "kb1234/003_ui")
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "rebase"}, &buf)
+	assert.Int(t, i).Equals(ErrRebasing)
+	assert.String(t, buf.String()).Equals(`Rebased kb1234/001_docs onto master
+Unable to rebase kb1234/002_api onto kb1234/001_docs, the stack is unchanged
+`)
+
+	repo = Reopen(t, repo)
+	assert.Repo(t, repo).Branch("kb1234/003_ui")
+	assert.Repo(t, repo).Parent("kb1234/002_api", "kb1234/001_docs")
+	assert.Repo(t, repo).Parent("kb1234/001_docs", "kb3456/001_migration")
+}
+
+func Test_rebase_defaults_to_recorded_base(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	InitialCommit(t, repo)
+	wt := WorkTree(t, repo)
+	CreateBranch(t, repo, "feature", "base")
+	Commit(t, wt, map[string]string{"base.go": "package base"}, "Add base.go")
+
+	i := Exec(Flags{SubCommand: "init", Name: "kb1234/docs"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	Commit(t, wt, map[string]string{"README.md": "Hello world"}, "Add README.md")
+
+	CheckoutBranch(t, wt, "feature/base")
+	Commit(t, wt, map[string]string{"LICENSE": "MIT"}, "Add LICENSE")
+	CheckoutBranch(t, wt, "kb1234/001_docs")
+
+	i = Exec(Flags{SubCommand: "rebase"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assert.Repo(t, repo).IsAncestor("feature/base", "kb1234/001_docs")
+}
+
+func Test_push_after_rebase_replaces_remote_layers(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+	t.Setenv("GITHUB_TOKEN", "")
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	wt := WorkTree(t, repo)
+	CheckoutBranch(t, wt, "master")
+	Commit(t, wt, map[string]string{"main.go": "package main"}, "Add main.go")
+	CheckoutBranch(t, wt, "kb1234/003_ui")
+
+	i = Exec(Flags{SubCommand: "rebase"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	i = Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	repo = Reopen(t, repo)
+	for _, l := range []string{"kb1234/001_docs", "kb1234/002_api", "kb1234/003_ui"} {
+		local, err := repo.Reference(plumbing.NewBranchReferenceName(l), true)
+		if err != nil {
+			t.Fatalf("call=Reference err=`%v`\n", err)
+		}
+		pushed, err := server.Repo.Reference(plumbing.NewBranchReferenceName(l), true)
+		if err != nil {
+			t.Fatalf("call=Reference err=`%v`\n", err)
+		}
+		assert.String(t, pushed.Hash().String()).Equals(local.Hash().String())
+	}
+}
+
+func Test_push_refuses_to_replace_unfetched_remote_layers(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+	t.Setenv("GITHUB_TOKEN", "")
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	// someone else moves the remote layer after it was pushed.
+	api, err := server.Repo.Reference(plumbing.NewBranchReferenceName("kb1234/002_api"), true)
+	if err != nil {
+		t.Fatalf("call=Reference err=`%v`\n", err)
+	}
+	err = server.Repo.Storer.SetReference(plumbing.NewHashReference(
+		plumbing.NewBranchReferenceName("kb1234/003_ui"), api.Hash()))
+	if err != nil {
+		t.Fatalf("call=SetReference err=`%v`\n", err)
+	}
+
+	wt := WorkTree(t, repo)
+	CheckoutBranch(t, wt, "master")
+	Commit(t, wt, map[string]string{"main.go": "package main"}, "Add main.go")
+	CheckoutBranch(t, wt, "kb1234/003_ui")
+
+	i = Exec(Flags{SubCommand: "rebase"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	i = Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(ErrPushingStack)
+}
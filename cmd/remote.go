@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+var errNoRemote = errors.New("no remotes configured")
+
+// Remote prints the default remote for the repository or, when a name is
+// given, persists it as stack.remote in the repository config along with
+// stack.<stack>.remote for the current stack.
+func Remote(input Flags, w io.Writer) int {
+	repo, _, err := openWorkTree()
+	if err != nil {
+		log.Printf("call=openWorkTree err=`%v`\n", err)
+		return ErrNotRepository
+	}
+
+	if input.Name == "" {
+		var stack string
+		if parts, err := headParts(repo); err == nil && isStack(parts) {
+			stack = parts[stackName]
+		}
+		remote, err := selectRemote(repo, "", stack)
+		if err != nil {
+			log.Printf("call=selectRemote err=`%v`\n", err)
+			return ErrInvalidArgument
+		}
+		fmt.Fprintln(w, remote.Config().Name)
+		return Success
+	}
+
+	_, err = repo.Remote(input.Name)
+	if err != nil {
+		log.Printf("call=Remote name=%s err=`%v`\n", input.Name, err)
+		return ErrInvalidArgument
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		log.Printf("call=Config err=`%v`\n", err)
+		return ErrNotRepository
+	}
+
+	cfg.Raw.Section("stack").SetOption("remote", input.Name)
+	if parts, err := headParts(repo); err == nil && isStack(parts) {
+		cfg.Raw.Section("stack").Subsection(parts[stackName]).SetOption("remote", input.Name)
+	}
+	err = repo.SetConfig(cfg)
+	if err != nil {
+		log.Printf("call=SetConfig err=`%v`\n", err)
+		return ErrNotRepository
+	}
+
+	return Success
+}
+
+// selectRemote returns the named remote or when name is empty the remote
+// recorded for stack, the stack.remote default, origin or the first remote
+// configured in that order.
+func selectRemote(repo *git.Repository, name, stack string) (*git.Remote, error) {
+	if name != "" {
+		r, err := repo.Remote(name)
+		if err != nil {
+			return nil, fmt.Errorf("call=Remote name=%s err=`%w`", name, err)
+		}
+		return r, nil
+	}
+
+	var recorded string
+	if stack != "" {
+		recorded = readStackMeta(repo, stack).Remote
+	}
+
+	for _, n := range []string{recorded, stackOption(repo, "remote"), git.DefaultRemoteName} {
+		if n == "" {
+			continue
+		}
+
+		r, err := repo.Remote(n)
+		if err == nil {
+			return r, nil
+		}
+	}
+
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return nil, fmt.Errorf("call=Remotes err=`%w`", err)
+	}
+
+	if len(remotes) < 1 {
+		return nil, errNoRemote
+	}
+
+	return remotes[0], nil
+}
+
+// fetchStack updates the remote-tracking refs of stack from remote, removing
+// those whose branch was deleted or renamed on the remote. A remote with
+// nothing pushed yet, such as a fresh fork, is not an error.
+func fetchStack(repo *git.Repository, remote *git.Remote, stack string) error {
+	name := remote.Config().Name
+	spec := config.RefSpec(fmt.Sprintf("+refs/heads/%[1]s/*:refs/remotes/%[2]s/%[1]s/*", stack, name))
+	err := withAuth(repo, remote, func(authcb transport.AuthMethod) error {
+		return repo.Fetch(&git.FetchOptions{
+			Auth:       authcb,
+			RemoteName: name,
+			RefSpecs:   []config.RefSpec{spec},
+			Prune:      true,
+		})
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate && err != transport.ErrEmptyRemoteRepository {
+		return fmt.Errorf("call=Fetch spec=%v err=`%w`", spec, err)
+	}
+
+	return nil
+}
+
+// trackingRefs returns the remote-tracking refs of stack for the named remote.
+func trackingRefs(repo *git.Repository, remote, stack string) ([]*plumbing.Reference, error) {
+	iter, err := repo.References()
+	if err != nil {
+		return nil, fmt.Errorf("call=References err=`%w`", err)
+	}
+
+	var a []*plumbing.Reference
+	prefix := trackingPrefix(remote, stack)
+	err = iter.ForEach(func(r *plumbing.Reference) error {
+		if isLayerRef(r.Name().String(), prefix) {
+			a = append(a, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("call=ForEach err=`%w`", err)
+	}
+
+	return a, nil
+}
+
+func trackingPrefix(remote, stack string) string {
+	return fmt.Sprintf("refs/remotes/%s/%s/", remote, stack)
+}
+
+// trackStack creates the local branches of stack from the remote-tracking refs
+// of the selected remote, refreshing them first when Fetch is set, and returns
+// the layers of the stack.
+func trackStack(repo *git.Repository, input Flags, stack string, w io.Writer) ([]string, error) {
+	remote, err := selectRemote(repo, input.Remote, stack)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Fetch {
+		err = fetchStack(repo, remote, stack)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	name := remote.Config().Name
+	refs, err := trackingRefs(repo, name, stack)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("stack %s not found locally or on %s", stack, name)
+	}
+
+	prefix := trackingPrefix(name, stack)
+	for _, r := range refs {
+		layer := stack + "/" + strings.TrimPrefix(r.Name().String(), prefix)
+		err = repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(layer), r.Hash()))
+		if err != nil {
+			return nil, fmt.Errorf("call=SetReference err=`%w`", err)
+		}
+		fmt.Fprintf(w, "Created %s from %s\n", layer, name)
+	}
+
+	return stackLayers(repo, stack)
+}
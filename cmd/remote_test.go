@@ -0,0 +1,200 @@
+package cmd_test
+
+import (
+	"bytes"
+	"github.com/nfisher/gitit/assert"
+	. "github.com/nfisher/gitit/cmd"
+	"io"
+	"testing"
+)
+
+func Test_remote_outside_repo_should_fail(t *testing.T) {
+	tdclose := CreateBareDir(t)
+	defer tdclose()
+
+	i := Exec(Flags{SubCommand: "remote"}, io.Discard)
+	assert.Int(t, i).Equals(ErrNotRepository)
+}
+
+func Test_remote_defaults_to_origin(t *testing.T) {
+	upstream, upclose := LaunchServer(t)
+	defer upclose()
+
+	origin, originclose := LaunchServer(t)
+	defer originclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	InitialCommit(t, repo)
+	CreateNamedRemote(t, repo, "upstream", upstream)
+	CreateRemote(t, repo, origin)
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "remote"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals("origin\n")
+}
+
+func Test_remote_rejects_unknown_remote(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	InitialCommit(t, repo)
+
+	i := Exec(Flags{SubCommand: "remote", Name: "fork"}, io.Discard)
+	assert.Int(t, i).Equals(ErrInvalidArgument)
+}
+
+func Test_remote_default_is_used_by_push_and_status(t *testing.T) {
+	origin, originclose := LaunchServer(t)
+	defer originclose()
+
+	fork, forkclose := LaunchServer(t)
+	defer forkclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, origin)
+	CreateNamedRemote(t, repo, "fork", fork)
+	PushBranch(t, repo, "master")
+	t.Setenv("GITHUB_TOKEN", "")
+
+	i := Exec(Flags{SubCommand: "remote", Name: "fork"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	var buf bytes.Buffer
+	i = Exec(Flags{SubCommand: "remote"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals("fork\n")
+
+	i = Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assert.Remote(t, fork.Address()).IncludesBranches(
+		"kb1234/001_docs",
+		"kb1234/002_api",
+		"kb1234/003_ui")
+	assert.Remote(t, origin.Address()).ExcludesBranches(
+		"kb1234/001_docs")
+
+	buf.Reset()
+	i = Exec(Flags{SubCommand: "status", Remote: "origin"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`In stack kb1234
+On branch kb1234/003_ui
+Remote origin
+
+Local Stack (+ ahead, - behind, = same, ∇ diverged):
+    (+) 001_docs a4f8278 Add README.md
+    (+) 002_api  e8decd8 Add api.js
+  * (+) 003_ui   cd73600 Add ui.js
+`)
+
+	buf.Reset()
+	i = Exec(Flags{SubCommand: "status"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`In stack kb1234
+On branch kb1234/003_ui
+Remote fork
+
+Local Stack (+ ahead, - behind, = same, ∇ diverged):
+    (=) 001_docs a4f8278 Add README.md
+    (=) 002_api  e8decd8 Add api.js
+  * (=) 003_ui   cd73600 Add ui.js
+`)
+}
+
+func Test_push_with_unknown_remote_fails(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+
+	i := Exec(Flags{SubCommand: "push", Remote: "fork"}, io.Discard)
+	assert.Int(t, i).Equals(ErrInvalidArgument)
+}
+
+func Test_remote_prefers_remote_recorded_for_stack(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateURLRemote(t, repo, "origin", "https://example.com/origin.git")
+	CreateURLRemote(t, repo, "upstream", "https://example.com/upstream.git")
+	out, err := GitCmd(t, "config", "stack.kb1234.remote", "upstream")
+	if err != nil {
+		t.Fatalf("call=GitCmd err=`%v` output=`%s`", err, out)
+	}
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "remote"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals("upstream\n")
+}
+
+func Test_init_keeps_repository_remote_for_fork_workflow(t *testing.T) {
+	origin, originclose := LaunchServer(t)
+	defer originclose()
+
+	fork, forkclose := LaunchServer(t)
+	defer forkclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	InitialCommit(t, repo)
+	CreateRemote(t, repo, origin)
+	CreateNamedRemote(t, repo, "fork", fork)
+	PushBranch(t, repo, "master")
+	out, err := GitCmd(t, "branch", "--set-upstream-to", "origin/master", "master")
+	if err != nil {
+		t.Fatalf("call=GitCmd err=`%v` output=`%s`", err, out)
+	}
+	t.Setenv("GITHUB_TOKEN", "")
+
+	i := Exec(Flags{SubCommand: "remote", Name: "fork"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	i = Exec(Flags{SubCommand: "init", Name: "kb/one"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	Commit(t, WorkTree(t, repo), map[string]string{"README.md": "Hello world"}, "Add README.md")
+
+	i = Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assert.Remote(t, fork.Address()).IncludesBranches("kb/001_one")
+	assert.Remote(t, origin.Address()).ExcludesBranches("kb/001_one")
+
+	var buf bytes.Buffer
+	i = Exec(Flags{SubCommand: "remote"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals("fork\n")
+}
+
+func Test_remote_records_remote_for_current_stack(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateURLRemote(t, repo, "origin", "https://example.com/origin.git")
+	CreateURLRemote(t, repo, "upstream", "https://example.com/upstream.git")
+	out, err := GitCmd(t, "config", "stack.kb1234.remote", "upstream")
+	if err != nil {
+		t.Fatalf("call=GitCmd err=`%v` output=`%s`", err, out)
+	}
+
+	i := Exec(Flags{SubCommand: "remote", Name: "origin"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	var buf bytes.Buffer
+	i = Exec(Flags{SubCommand: "remote"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals("origin\n")
+
+	out, err = GitCmd(t, "config", "--get", "stack.kb1234.remote")
+	if err != nil {
+		t.Fatalf("call=GitCmd err=`%v` output=`%s`", err, out)
+	}
+	assert.String(t, out).Equals("origin\n")
+}
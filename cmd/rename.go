@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Rename renames the current stack, every layer branch and its metadata. The
+// old branches are removed from the remote on the next push or immediately
+// along with pushing the new ones when RemoteBranches is set.
+func Rename(input Flags, w io.Writer) int {
+	if input.Name == "" {
+		log.Printf("call=Name err=`stack name is empty, must be specified`\n")
+		return ErrMissingArguments
+	}
+
+	repo, _, err := openWorkTree()
+	if err != nil {
+		log.Printf("call=openWorkTree err=`%v`\n", err)
+		return ErrNotRepository
+	}
+
+	parts, err := headParts(repo)
+	if err != nil {
+		log.Printf("call=headParts err=`%v`\n", err)
+		return ErrHead
+	}
+
+	if !isStack(parts) {
+		log.Printf("call=Split err=`want 4 parts, got %d`\n", len(parts))
+		return ErrInvalidStack
+	}
+
+	stack := parts[stackName]
+	if strings.Contains(input.Name, "/") {
+		log.Printf("call=Contains err=`%s is not a valid stack name`\n", input.Name)
+		return ErrInvalidArgument
+	}
+	if err := plumbing.NewBranchReferenceName(input.Name + "/" + parts[stackBranch]).Validate(); err != nil {
+		log.Printf("call=Validate name=%s err=`%v`\n", input.Name, err)
+		return ErrInvalidArgument
+	}
+
+	if _, err := stackLayers(repo, input.Name); err == nil {
+		log.Printf("call=Rename err=`stack %s already exists`\n", input.Name)
+		return ErrStackExists
+	}
+
+	layers, err := stackLayers(repo, stack)
+	if err != nil {
+		log.Printf("call=stackLayers err=`%v`\n", err)
+		return ErrUnknownBranch
+	}
+
+	var remote *git.Remote
+	if input.RemoteBranches {
+		remote, err = selectRemote(repo, input.Remote, stack)
+		if err != nil {
+			log.Printf("call=selectRemote err=`%v`\n", err)
+			return ErrInvalidArgument
+		}
+	}
+
+	err = moveStackMeta(repo, stack, input.Name)
+	if err != nil {
+		log.Printf("call=moveStackMeta err=`%v`\n", err)
+		return ErrCreatingBranch
+	}
+
+	var renames []rename
+	for _, l := range layers {
+		renames = append(renames, rename{old: l, new: input.Name + strings.TrimPrefix(l, stack)})
+	}
+
+	err = renameBranches(repo, input.Name, renames, w)
+	if err != nil {
+		log.Printf("call=renameBranches err=`%v`\n", err)
+		return ErrCreatingBranch
+	}
+
+	if remote == nil {
+		return Success
+	}
+
+	stale, err := renameRemote(repo, remote, input.Name, false, w)
+	if err != nil {
+		log.Printf("call=renameRemote err=`%v`\n", err)
+		return ErrPushingStack
+	}
+
+	err = pushStack(repo, remote, input.Name, w)
+	if err != nil {
+		log.Printf("call=pushStack err=`%v`\n", err)
+		return ErrPushingStack
+	}
+
+	err = pruneRenamed(repo, remote, input.Name, stale, false, w)
+	if err != nil {
+		log.Printf("call=pruneRenamed err=`%v`\n", err)
+		return ErrPushingStack
+	}
+
+	err = syncPullRequests(repo, remote, input.Name, false, w)
+	if err != nil {
+		log.Printf("call=syncPullRequests err=`%v`\n", err)
+		return ErrPullRequest
+	}
+
+	fmt.Fprintf(w, "Pushed %s to %s\n", input.Name, remote.Config().Name)
+	return Success
+}
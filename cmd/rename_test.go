@@ -0,0 +1,122 @@
+package cmd_test
+
+import (
+	"bytes"
+	"github.com/nfisher/gitit/assert"
+	. "github.com/nfisher/gitit/cmd"
+	"io"
+	"testing"
+)
+
+func Test_rename_returns_missing_arguments_without_name(t *testing.T) {
+	i := Exec(Flags{SubCommand: "rename"}, io.Discard)
+	assert.Int(t, i).Equals(ErrMissingArguments)
+}
+
+func Test_rename_outside_stack_fails(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	InitialCommit(t, repo)
+
+	i := Exec(Flags{SubCommand: "rename", Name: "kb9999"}, io.Discard)
+	assert.Int(t, i).Equals(ErrInvalidStack)
+}
+
+func Test_rename_refuses_existing_or_invalid_stack(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	CreateThreeLayerStack(t, repo)
+
+	i := Exec(Flags{SubCommand: "rename", Name: "kb3456"}, io.Discard)
+	assert.Int(t, i).Equals(ErrStackExists)
+
+	for _, name := range []string{"kb/9999", "kb 9999", "kb..9999"} {
+		i = Exec(Flags{SubCommand: "rename", Name: name}, io.Discard)
+		if i != ErrInvalidArgument {
+			t.Errorf("rename %q = %d, want %d", name, i, ErrInvalidArgument)
+		}
+	}
+	assert.Repo(t, repo).Branch("kb1234/003_ui")
+}
+
+func Test_rename_moves_branches_and_metadata(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	InitialCommit(t, repo)
+
+	i := Exec(Flags{SubCommand: "init", Name: "kb1234/docs"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	Commit(t, WorkTree(t, repo), map[string]string{"README.md": "Hello world"}, "Add README.md")
+	i = Exec(Flags{SubCommand: "branch", Name: "api"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	var buf bytes.Buffer
+	i = Exec(Flags{SubCommand: "rename", Name: "kb9999"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`Renamed branch kb1234/001_docs to kb9999/001_docs
+Renamed branch kb1234/002_api to kb9999/002_api
+`)
+	assert.Repo(t, repo).Branch("kb9999/002_api")
+	assert.Repo(t, repo).ExcludesBranches("kb1234/001_docs", "kb1234/002_api")
+
+	got, err := GitCmd(t, "config", "--get", "stack.kb9999.base")
+	if err != nil {
+		t.Fatalf("call=GitCmd err=`%v` output=`%s`", err, got)
+	}
+	assert.String(t, got).Equals("master\n")
+
+	_, err = GitCmd(t, "config", "--get", "stack.kb1234.base")
+	if err == nil {
+		t.Errorf("stack.kb1234.base should be removed")
+	}
+}
+
+func Test_rename_remote_branches(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+	t.Setenv("GITHUB_TOKEN", "")
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	i = Exec(Flags{SubCommand: "rename", Name: "kb9999", RemoteBranches: true}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assert.Remote(t, server.Address()).IncludesBranches(
+		"kb9999/001_docs",
+		"kb9999/002_api",
+		"kb9999/003_ui")
+	assert.Remote(t, server.Address()).ExcludesBranches(
+		"kb1234/001_docs",
+		"kb1234/002_api",
+		"kb1234/003_ui")
+}
+
+func Test_push_after_rename_removes_old_branches(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+	t.Setenv("GITHUB_TOKEN", "")
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	i = Exec(Flags{SubCommand: "rename", Name: "kb9999"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assert.Remote(t, server.Address()).IncludesBranches("kb1234/001_docs")
+
+	i = Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assert.Remote(t, server.Address()).IncludesBranches("kb9999/001_docs", "kb9999/002_api", "kb9999/003_ui")
+	assert.Remote(t, server.Address()).ExcludesBranches("kb1234/001_docs", "kb1234/002_api", "kb1234/003_ui")
+}
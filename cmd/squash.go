@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Squash collapses the commits unique to a layer into a single commit using
+// the first commit's message. When no layer is specified every layer in the
+// stack is squashed. Layers above a squashed layer are re-parented onto the
+// result so the stack remains consistent.
+func Squash(input Flags, w io.Writer) int {
+	repo, _, err := openWorkTree()
+	if err != nil {
+		log.Printf("call=openWorkTree err=`%v`\n", err)
+		return ErrNotRepository
+	}
+
+	parts, err := headParts(repo)
+	if err != nil {
+		log.Printf("call=headParts err=`%v`\n", err)
+		return ErrHead
+	}
+
+	if !isStack(parts) {
+		log.Printf("call=Split err=`want 4 parts, got %d`\n", len(parts))
+		return ErrInvalidStack
+	}
+
+	layers, err := stackLayers(repo, parts[stackName])
+	if err != nil {
+		log.Printf("call=stackLayers err=`%v`\n", err)
+		return ErrUnknownBranch
+	}
+
+	var target string
+	if input.Name != "" {
+		var code int
+		target, code = findLayer(layers, input.Name, w)
+		if code != Success {
+			return code
+		}
+	}
+	isTarget := func(layer string) bool {
+		return target == "" || layer == target
+	}
+
+	trunk, err := stackTrunk(repo, parts[stackName])
+	if err != nil {
+		log.Printf("call=stackTrunk err=`%v`\n", err)
+		return ErrUnknownBranch
+	}
+
+	base, err := mergeBase(repo, trunk, layers[0])
+	if err != nil {
+		log.Printf("call=mergeBase err=`%v`\n", err)
+		return ErrUnknownBranch
+	}
+
+	prevOld, prevNew := base, base
+	for _, l := range layers {
+		name := plumbing.NewBranchReferenceName(l)
+		ref, err := repo.Reference(name, true)
+		if err != nil {
+			log.Printf("call=Reference err=`%v`\n", err)
+			return ErrUnknownBranch
+		}
+
+		commits, err := uniqueCommits(repo, ref.Hash(), prevOld)
+		if err != nil {
+			log.Printf("call=uniqueCommits branch=%s err=`%v`\n", l, err)
+			return ErrInvalidStack
+		}
+
+		tip := ref.Hash()
+		if isTarget(l) && len(commits) > 1 {
+			tip, err = squashCommits(repo, commits, prevNew)
+			if err != nil {
+				log.Printf("call=squashCommits err=`%v`\n", err)
+				return ErrSquashing
+			}
+			fmt.Fprintf(w, "Squashed %d commits in %s\n", len(commits), l)
+		} else if prevNew != prevOld {
+			tip, err = replayCommits(repo, commits, prevNew)
+			if err != nil {
+				log.Printf("call=replayCommits err=`%v`\n", err)
+				return ErrSquashing
+			}
+			fmt.Fprintf(w, "Restacked %s\n", l)
+		}
+
+		if tip != ref.Hash() {
+			err = repo.Storer.SetReference(plumbing.NewHashReference(name, tip))
+			if err != nil {
+				log.Printf("call=SetReference err=`%v`\n", err)
+				return ErrSquashing
+			}
+		}
+
+		prevOld, prevNew = ref.Hash(), tip
+	}
+
+	return Success
+}
+
+// mergeBase returns the best common ancestor of the branches a and b.
+func mergeBase(repo *git.Repository, a, b string) (plumbing.Hash, error) {
+	ca, err := branchCommit(repo, a)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	cb, err := branchCommit(repo, b)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	bases, err := ca.MergeBase(cb)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("call=MergeBase err=`%w`", err)
+	}
+
+	if len(bases) == 0 {
+		return plumbing.ZeroHash, fmt.Errorf("%s and %s have no common ancestor", a, b)
+	}
+
+	return bases[0].Hash, nil
+}
+
+func branchCommit(repo *git.Repository, name string) (*object.Commit, error) {
+	ref, err := repo.Reference(plumbing.NewBranchReferenceName(name), true)
+	if err != nil {
+		return nil, fmt.Errorf("call=Reference branch=%s err=`%w`", name, err)
+	}
+
+	c, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("call=CommitObject err=`%w`", err)
+	}
+
+	return c, nil
+}
+
+// uniqueCommits walks the first parent of tip until base is reached and
+// returns the visited commits oldest first.
+func uniqueCommits(repo *git.Repository, tip, base plumbing.Hash) ([]*object.Commit, error) {
+	var a []*object.Commit
+	h := tip
+	for h != base {
+		c, err := repo.CommitObject(h)
+		if err != nil {
+			return nil, fmt.Errorf("call=CommitObject err=`%w`", err)
+		}
+
+		if c.NumParents() == 0 {
+			return nil, fmt.Errorf("%v is not an ancestor of %v, rebase the stack first", base, tip)
+		}
+
+		a = append([]*object.Commit{c}, a...)
+		h = c.ParentHashes[0]
+	}
+
+	return a, nil
+}
+
+// squashCommits writes a single commit with the tree of the last commit onto
+// parent using the first commits message and author.
+func squashCommits(repo *git.Repository, commits []*object.Commit, parent plumbing.Hash) (plumbing.Hash, error) {
+	first := commits[0]
+	last := commits[len(commits)-1]
+	committer := last.Committer
+	committer.When = time.Now()
+
+	c := &object.Commit{
+		Author:       first.Author,
+		Committer:    committer,
+		Message:      first.Message,
+		TreeHash:     last.TreeHash,
+		ParentHashes: []plumbing.Hash{parent},
+	}
+
+	return storeCommit(repo, c)
+}
+
+// replayCommits copies commits onto parent. The trees are reused as is which
+// is only valid when parent has the same tree as the commits original base.
+func replayCommits(repo *git.Repository, commits []*object.Commit, parent plumbing.Hash) (plumbing.Hash, error) {
+	for _, o := range commits {
+		c := &object.Commit{
+			Author:       o.Author,
+			Committer:    o.Committer,
+			Message:      o.Message,
+			TreeHash:     o.TreeHash,
+			ParentHashes: append([]plumbing.Hash{parent}, o.ParentHashes[1:]...),
+		}
+
+		var err error
+		parent, err = storeCommit(repo, c)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	return parent, nil
+}
+
+func storeCommit(repo *git.Repository, c *object.Commit) (plumbing.Hash, error) {
+	obj := repo.Storer.NewEncodedObject()
+	err := c.Encode(obj)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("call=Encode err=`%w`", err)
+	}
+
+	h, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("call=SetEncodedObject err=`%w`", err)
+	}
+
+	return h, nil
+}
@@ -0,0 +1,84 @@
+package cmd_test
+
+import (
+	"github.com/nfisher/gitit/assert"
+	. "github.com/nfisher/gitit/cmd"
+	"io"
+	"testing"
+)
+
+func Test_squash_outside_repo_should_fail(t *testing.T) {
+	tdclose := CreateBareDir(t)
+	defer tdclose()
+
+	i := Exec(Flags{SubCommand: "squash"}, io.Discard)
+	assert.Int(t, i).Equals(ErrNotRepository)
+}
+
+func Test_squash_on_invalid_stack_fails(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	InitialCommit(t, repo)
+
+	i := Exec(Flags{SubCommand: "squash"}, io.Discard)
+	assert.Int(t, i).Equals(ErrInvalidStack)
+}
+
+func Test_squash_returns_unknown_branch_with_absent_branch_id(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+
+	i := Exec(Flags{SubCommand: "squash", Name: "004"}, io.Discard)
+	assert.Int(t, i).Equals(ErrUnknownBranch)
+}
+
+func Test_squash_zero_does_not_match_every_layer(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+
+	i := Exec(Flags{SubCommand: "squash", Name: "0"}, io.Discard)
+	assert.Int(t, i).Equals(ErrUnknownBranch)
+	assert.Repo(t, repo).Parent("kb1234/003_ui", "kb1234/002_api")
+}
+
+func Test_squash_layer_restacks_higher_layers(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	wt := WorkTree(t, repo)
+	InitialCommit(t, repo)
+	InitStack(t, repo, "kb1234", "001_docs")
+	Commit(t, wt, map[string]string{"README.md": "Hello world"}, "Add README.md")
+	CreateBranch(t, repo, "kb1234", "002_api")
+	Commit(t, wt, map[string]string{"api.js": "function api() {}"}, "Add api.js")
+	Commit(t, wt, map[string]string{"api.js": "function api() { return true; }"}, "Update api.js")
+	CreateBranch(t, repo, "kb1234", "003_ui")
+	Commit(t, wt, map[string]string{"ui.js": "function ui() {}"}, "Add ui.js")
+
+	i := Exec(Flags{SubCommand: "squash", Name: "002"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assert.Repo(t, repo).Branch("kb1234/003_ui")
+	assert.Repo(t, repo).Parent("kb1234/002_api", "kb1234/001_docs")
+	assert.Repo(t, repo).Message("kb1234/002_api", "Add api.js")
+	assert.Repo(t, repo).Parent("kb1234/003_ui", "kb1234/002_api")
+	assert.Exists(t, "ui.js")
+}
+
+func Test_squash_all_layers_relative_to_trunk(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+
+	i := Exec(Flags{SubCommand: "squash"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assert.Repo(t, repo).Parent("kb1234/001_docs", "master")
+	assert.Repo(t, repo).Message("kb1234/001_docs", "Add 001_create.sql")
+	assert.Repo(t, repo).Parent("kb1234/002_api", "kb1234/001_docs")
+	assert.Repo(t, repo).Parent("kb1234/003_ui", "kb1234/002_api")
+}
@@ -0,0 +1,368 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/kevinburke/ssh_config"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/term"
+)
+
+// sshOptions are the settings that determine how to authenticate with an SSH
+// remote gathered from the remote URL, the ssh command and ~/.ssh/config.
+type sshOptions struct {
+	User           string
+	IdentityFiles  []string
+	KnownHosts     []string
+	IgnoreHostKeys bool
+}
+
+// sshAuth returns public key auth for the SSH remote URL. Signers from the
+// agent are offered first followed by the identity files named in
+// core.sshCommand or GIT_SSH_COMMAND, ~/.ssh/config and the default keys. The
+// identity files are only loaded when the server rejects the agent's keys.
+func sshAuth(repo *git.Repository, rawURL string) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("call=NewEndpoint err=`%w`", err)
+	}
+
+	opts := sshCommandOptions(sshCommand(repo))
+	cfg := userSSHConfig()
+
+	user := ep.User
+	if user == "" {
+		user = opts.User
+	}
+	if user == "" && cfg != nil {
+		user, _ = cfg.Get(ep.Host, "User")
+	}
+	if user == "" {
+		user = "git"
+	}
+
+	files := opts.IdentityFiles
+	if cfg != nil {
+		a, _ := cfg.GetAll(ep.Host, "IdentityFile")
+		files = append(files, a...)
+		if len(opts.KnownHosts) == 0 {
+			s, _ := cfg.Get(ep.Host, "UserKnownHostsFile")
+			opts.KnownHosts = strings.Fields(s)
+		}
+		if s, _ := cfg.Get(ep.Host, "StrictHostKeyChecking"); s == "no" {
+			opts.IgnoreHostKeys = true
+		}
+	}
+	files = append(files, defaultIdentityFiles()...)
+
+	var seen = map[string]bool{}
+	var paths []string
+	for _, f := range files {
+		f = expandHome(f)
+		if !seen[f] {
+			seen[f] = true
+			paths = append(paths, f)
+		}
+	}
+
+	auth := &keysAuth{
+		PublicKeysCallback: gitssh.PublicKeysCallback{User: user},
+		host:               ep.Host,
+		files:              paths,
+	}
+
+	switch {
+	case opts.IgnoreHostKeys:
+		auth.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	case len(opts.KnownHosts) > 0:
+		var hosts []string
+		for _, f := range opts.KnownHosts {
+			hosts = append(hosts, expandHome(f))
+		}
+		auth.HostKeyCallback, err = gitssh.NewKnownHostsCallback(hosts...)
+		if err != nil {
+			return nil, fmt.Errorf("call=NewKnownHostsCallback err=`%w`", err)
+		}
+	}
+
+	return auth, nil
+}
+
+// keysAuth authenticates with the agent's keys and, when the server rejects
+// them, with the identity files. The files are loaded once on first use so an
+// encrypted key only asks for its passphrase when it is needed.
+type keysAuth struct {
+	gitssh.PublicKeysCallback
+	host  string
+	files []string
+
+	once    sync.Once
+	signers []ssh.Signer
+}
+
+func (a *keysAuth) ClientConfig() (*ssh.ClientConfig, error) {
+	// each connection starts over with the agent, the retry offers the files.
+	var agentTried, filesTried bool
+	callback := func() ([]ssh.Signer, error) {
+		if !agentTried {
+			agentTried = true
+			if signers := agentSigners(); len(signers) > 0 {
+				return signers, nil
+			}
+		}
+		if filesTried {
+			return nil, nil
+		}
+		filesTried = true
+
+		signers := a.identities()
+		if len(signers) == 0 {
+			return nil, fmt.Errorf("no ssh identities found for %s@%s", a.User, a.host)
+		}
+		return signers, nil
+	}
+
+	return a.SetHostKeyCallback(&ssh.ClientConfig{
+		User: a.User,
+		Auth: []ssh.AuthMethod{ssh.RetryableAuthMethod(ssh.PublicKeysCallback(callback), 2)},
+	})
+}
+
+// identities returns the signers of the identity files that could be loaded.
+func (a *keysAuth) identities() []ssh.Signer {
+	a.once.Do(func() {
+		for _, f := range a.files {
+			signer, err := loadIdentity(f)
+			if err != nil {
+				continue
+			}
+			a.signers = append(a.signers, signer)
+		}
+	})
+	return a.signers
+}
+
+// agentSigners returns the keys held by the agent at SSH_AUTH_SOCK. The
+// connection is closed once the keys are listed and each signature dials the
+// agent again.
+func agentSigners() []ssh.Signer {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	keys, err := agent.NewClient(conn).List()
+	if err != nil {
+		return nil
+	}
+
+	var a []ssh.Signer
+	for _, k := range keys {
+		a = append(a, &agentSigner{sock: sock, key: k})
+	}
+	return a
+}
+
+// agentSigner signs with a key held by the agent.
+type agentSigner struct {
+	sock string
+	key  *agent.Key
+}
+
+func (s *agentSigner) PublicKey() ssh.PublicKey {
+	return s.key
+}
+
+func (s *agentSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.SignWithAlgorithm(rand, data, "")
+}
+
+func (s *agentSigner) SignWithAlgorithm(_ io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	var flags agent.SignatureFlags
+	switch algorithm {
+	case ssh.KeyAlgoRSASHA256:
+		flags = agent.SignatureFlagRsaSha256
+	case ssh.KeyAlgoRSASHA512:
+		flags = agent.SignatureFlagRsaSha512
+	}
+
+	conn, err := net.Dial("unix", s.sock)
+	if err != nil {
+		return nil, fmt.Errorf("call=Dial err=`%w`", err)
+	}
+	defer conn.Close()
+
+	return agent.NewClient(conn).SignWithFlags(s.key, data, flags)
+}
+
+// sshCommand returns GIT_SSH_COMMAND or core.sshCommand.
+func sshCommand(repo *git.Repository) string {
+	if s := os.Getenv("GIT_SSH_COMMAND"); s != "" {
+		return s
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return ""
+	}
+	return cfg.Raw.Section("core").Option("sshCommand")
+}
+
+// sshCommandOptions extracts the identity files, user and host key settings
+// from an ssh command line such as `ssh -i ~/.ssh/deploy -o StrictHostKeyChecking=no`.
+func sshCommandOptions(command string) sshOptions {
+	var opts sshOptions
+	args := splitCommand(command)
+	for i := 1; i < len(args); i++ {
+		var next string
+		if i+1 < len(args) {
+			next = args[i+1]
+		}
+
+		switch args[i] {
+		case "-i":
+			opts.IdentityFiles = append(opts.IdentityFiles, next)
+			i++
+		case "-l":
+			opts.User = next
+			i++
+		case "-o":
+			k, v, _ := strings.Cut(next, "=")
+			switch strings.ToLower(k) {
+			case "identityfile":
+				opts.IdentityFiles = append(opts.IdentityFiles, v)
+			case "user":
+				opts.User = v
+			case "userknownhostsfile":
+				opts.KnownHosts = append(opts.KnownHosts, strings.Fields(v)...)
+			case "stricthostkeychecking":
+				opts.IgnoreHostKeys = v == "no"
+			}
+			i++
+		}
+	}
+	return opts
+}
+
+// splitCommand splits a command line on whitespace honouring quotes.
+func splitCommand(s string) []string {
+	var a []string
+	var sb strings.Builder
+	var quote rune
+	var inWord bool
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			sb.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				a = append(a, sb.String())
+				sb.Reset()
+				inWord = false
+			}
+		default:
+			sb.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		a = append(a, sb.String())
+	}
+	return a
+}
+
+func userSSHConfig() *ssh_config.Config {
+	f, err := os.Open(expandHome("~/.ssh/config"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	cfg, err := ssh_config.Decode(f)
+	if err != nil {
+		return nil
+	}
+	return cfg
+}
+
+func defaultIdentityFiles() []string {
+	var a []string
+	for _, n := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		a = append(a, filepath.Join("~", ".ssh", n))
+	}
+	return a
+}
+
+func expandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, p[1:])
+}
+
+// loadIdentity parses the private key at path. Encrypted keys are decrypted
+// with GIT_STACK_SSH_PASSPHRASE or a passphrase read from the terminal.
+func loadIdentity(path string) (ssh.Signer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(b)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return signer, err
+	}
+
+	passphrase, err := readPassphrase(path)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKeyWithPassphrase(b, passphrase)
+}
+
+func readPassphrase(path string) ([]byte, error) {
+	if s := os.Getenv("GIT_STACK_SSH_PASSPHRASE"); s != "" {
+		return []byte(s), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("passphrase required for %s", path)
+	}
+
+	fmt.Fprintf(os.Stderr, "Enter passphrase for key '%s': ", path)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("call=ReadPassword err=`%w`", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,148 @@
+package cmd_test
+
+import (
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/nfisher/gitit/assert"
+	. "github.com/nfisher/gitit/cmd"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func sshHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	t.Setenv("GIT_SSH_COMMAND", "")
+	t.Setenv("GIT_STACK_SSH_PASSPHRASE", "")
+	t.Setenv("GITHUB_TOKEN", "")
+	return home
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	err := os.WriteFile(path, []byte(contents), 0600)
+	if err != nil {
+		t.Fatalf("call=WriteFile err=`%v`\n", err)
+	}
+}
+
+func assertServerBranch(t *testing.T, s *sshServer, name string) {
+	t.Helper()
+	_, err := s.Repo.Reference(plumbing.NewBranchReferenceName(name), true)
+	if err != nil {
+		t.Fatalf("want branch %v on server, got err=`%v`\n", name, err)
+	}
+}
+
+func Test_push_over_ssh_with_identity_from_ssh_config(t *testing.T) {
+	home := sshHome(t)
+	key := GenerateIdentity(t, filepath.Join(home, ".ssh", "deploy"), "")
+	writeFile(t, filepath.Join(home, ".ssh", "config"), "Host localhost\n  IdentityFile ~/.ssh/deploy\n")
+
+	server, srvclose := LaunchSSHServer(t, "stacker", key)
+	defer srvclose()
+	writeFile(t, filepath.Join(home, ".ssh", "known_hosts"), server.KnownHostsLine())
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateURLRemote(t, repo, "origin", server.URL("stacker"))
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assertServerBranch(t, server, "kb1234/003_ui")
+
+	i = Exec(Flags{SubCommand: "status", Fetch: true}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+}
+
+func Test_push_over_ssh_with_unknown_host_fails(t *testing.T) {
+	home := sshHome(t)
+	key := GenerateIdentity(t, filepath.Join(home, ".ssh", "id_ed25519"), "")
+
+	server, srvclose := LaunchSSHServer(t, "stacker", key)
+	defer srvclose()
+	writeFile(t, filepath.Join(home, ".ssh", "known_hosts"), "")
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateURLRemote(t, repo, "origin", server.URL("stacker"))
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(ErrPushingStack)
+}
+
+func Test_push_over_ssh_with_ssh_command_and_passphrase(t *testing.T) {
+	home := sshHome(t)
+	key := GenerateIdentity(t, filepath.Join(home, "keys", "ci"), "hunter2")
+	t.Setenv("GIT_STACK_SSH_PASSPHRASE", "hunter2")
+
+	server, srvclose := LaunchSSHServer(t, "stacker", key)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateURLRemote(t, repo, "origin", server.URL("stacker"))
+
+	_, err := GitCmd(t, "config", "core.sshCommand", "ssh -i '"+filepath.Join(home, "keys", "ci")+"' -o StrictHostKeyChecking=no")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assertServerBranch(t, server, "kb1234/001_docs")
+}
+
+func Test_push_over_ssh_with_agent(t *testing.T) {
+	home := sshHome(t)
+	key := GenerateIdentity(t, filepath.Join(home, "agent", "id"), "")
+	GenerateIdentity(t, filepath.Join(home, ".ssh", "id_ed25519"), "hunter2")
+	agentclose := LaunchAgent(t, filepath.Join(home, "agent", "id"))
+	defer agentclose()
+
+	server, srvclose := LaunchSSHServer(t, "stacker", key)
+	defer srvclose()
+	writeFile(t, filepath.Join(home, ".ssh", "known_hosts"), server.KnownHostsLine())
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateURLRemote(t, repo, "origin", server.URL("stacker"))
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assertServerBranch(t, server, "kb1234/003_ui")
+}
+
+func Test_push_over_ssh_falls_back_to_identity_when_agent_key_rejected(t *testing.T) {
+	home := sshHome(t)
+	GenerateIdentity(t, filepath.Join(home, "agent", "id"), "")
+	key := GenerateIdentity(t, filepath.Join(home, ".ssh", "id_ed25519"), "hunter2")
+	t.Setenv("GIT_STACK_SSH_PASSPHRASE", "hunter2")
+	agentclose := LaunchAgent(t, filepath.Join(home, "agent", "id"))
+	defer agentclose()
+
+	server, srvclose := LaunchSSHServer(t, "stacker", key)
+	defer srvclose()
+	writeFile(t, filepath.Join(home, ".ssh", "known_hosts"), server.KnownHostsLine())
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateURLRemote(t, repo, "origin", server.URL("stacker"))
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	assertServerBranch(t, server, "kb1234/003_ui")
+}
@@ -2,9 +2,12 @@ package cmd_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/nfisher/gitit/assert"
 	. "github.com/nfisher/gitit/cmd"
 	"io"
+	"strings"
 	"testing"
 )
 
@@ -27,9 +30,9 @@ const smallStack = `In stack kb1234
 On branch kb1234/003_ui
 
 Local Stack:
-    001_docs
-    002_api
-    003_ui
+    001_docs a4f8278 Add README.md
+    002_api  e8decd8 Add api.js
+  * 003_ui   cd73600 Add ui.js
 `
 
 func Test_status_on_stack_returns_success(t *testing.T) {
@@ -72,10 +75,10 @@ func Test_status_with_default_remote_successful(t *testing.T) {
 On branch kb1234/003_ui
 Remote origin
 
-Local Stack (+ ahead, = same, ∇ diverged):
-    (=) 001_docs
-    (=) 002_api
-    (+) 003_ui
+Local Stack (+ ahead, - behind, = same, ∇ diverged):
+    (=) 001_docs a4f8278 Add README.md
+    (=) 002_api  e8decd8 Add api.js
+  * (+) 003_ui   cd73600 Add ui.js
 `)
 }
 
@@ -119,25 +122,498 @@ func Test_status_with_diverged_remote_successful(t *testing.T) {
 On branch kb1234/003_ui
 Remote origin
 
-Local Stack (+ ahead, = same, ∇ diverged):
-    (=) 001_docs
-    (=) 002_api
-    (+) 003_ui
+Local Stack (+ ahead, - behind, = same, ∇ diverged):
+    (=) 001_docs a4f8278 Add README.md
+    (=) 002_api  e8decd8 Add api.js
+  * (+) 003_ui   710a869 Update ui.js [ahead 1, behind 0]
 `)
 	PushBranch(t, repo2, "kb1234/003_ui")
 
 	Chdir(t, wt1)
 
 	var buf1 bytes.Buffer
-	i = Exec(Flags{SubCommand: "status"}, &buf1)
+	i = Exec(Flags{SubCommand: "status", Fetch: true}, &buf1)
 	assert.Int(t, i).Equals(Success)
 	assert.String(t, string(buf1.Bytes())).Equals(`In stack kb1234
 On branch kb1234/002_api
 Remote origin
 
-Local Stack (+ ahead, = same, ∇ diverged):
-    (=) 001_docs
-    (+) 002_api
-    (∇) 003_ui
+Local Stack (+ ahead, - behind, = same, ∇ diverged):
+    (=) 001_docs a4f8278 Add README.md
+  * (+) 002_api  1746aec Update api.js [ahead 1, behind 0]
+    (-) 003_ui   cd73600 Add ui.js [ahead 0, behind 1]
+`)
+}
+
+func Test_status_shows_pull_request_state(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+
+	PushBranch(t, repo, "kb1234/001_docs")
+	PushBranch(t, repo, "kb1234/002_api")
+
+	FakePullRequests(t,
+		PullRequest{Head: "kb1234/001_docs", State: "closed", Merged: true, URL: "https://github.com/nfisher/gitit/pull/1"},
+		PullRequest{Head: "kb1234/002_api", State: "open", URL: "https://github.com/nfisher/gitit/pull/2"},
+		PullRequest{Head: "kb1234/003_ui", State: "open", Failing: true, URL: "https://github.com/nfisher/gitit/pull/3"})
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "status", Fetch: true}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, string(buf.Bytes())).Equals(`In stack kb1234
+On branch kb1234/003_ui
+Remote origin
+
+Local Stack (+ ahead, - behind, = same, ∇ diverged):
+    (=) 001_docs a4f8278 Add README.md 🚢 https://github.com/nfisher/gitit/pull/1
+    (=) 002_api  e8decd8 Add api.js ✅ https://github.com/nfisher/gitit/pull/2
+  * (+) 003_ui   cd73600 Add ui.js ❌ https://github.com/nfisher/gitit/pull/3
+`)
+}
+
+func Test_status_looks_up_pull_requests_on_github(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+
+	_, ghclose := LaunchGitHub(t, repo)
+	defer ghclose()
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	var buf bytes.Buffer
+	i = Exec(Flags{SubCommand: "status", Fetch: true}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, string(buf.Bytes())).Equals(`In stack kb1234
+On branch kb1234/003_ui
+Remote origin
+
+Local Stack (+ ahead, - behind, = same, ∇ diverged):
+    (=) 001_docs a4f8278 Add README.md ✅ https://github.com/nfisher/gitit/pull/1
+    (=) 002_api  e8decd8 Add api.js ✅ https://github.com/nfisher/gitit/pull/2
+  * (=) 003_ui   cd73600 Add ui.js ✅ https://github.com/nfisher/gitit/pull/3
+`)
+}
+
+func Test_status_marks_squash_merged_layers(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	wt := WorkTree(t, repo)
+	CheckoutBranch(t, wt, "master")
+	Commit(t, wt, map[string]string{
+		"001_create.sql": "SELECT 1;",
+		"README.md":      "Hello world",
+	}, "Add docs (#1)")
+	CheckoutBranch(t, wt, "kb1234/002_api")
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "status"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, string(buf.Bytes())).Equals(`In stack kb1234
+On branch kb1234/002_api
+
+Local Stack:
+    001_docs a4f8278 Add README.md 🚢
+  * 002_api  e8decd8 Add api.js
+    003_ui   cd73600 Add ui.js
+`)
+}
+
+func Test_status_marks_squash_merged_layers_under_later_trunk_commits(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	wt := WorkTree(t, repo)
+	CheckoutBranch(t, wt, "master")
+	Commit(t, wt, map[string]string{
+		"001_create.sql": "SELECT 1;",
+		"README.md":      "Hello world",
+	}, "Add docs (#1)")
+	Commit(t, wt, map[string]string{"README.md": "Hello world!"}, "Punctuate README.md")
+	Commit(t, wt, map[string]string{"main.go": "package main"}, "Add main.go")
+	CheckoutBranch(t, wt, "kb1234/002_api")
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "status"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, string(buf.Bytes())).Equals(`In stack kb1234
+On branch kb1234/002_api
+
+Local Stack:
+    001_docs a4f8278 Add README.md 🚢
+  * 002_api  e8decd8 Add api.js
+    003_ui   cd73600 Add ui.js
+`)
+}
+
+func Test_status_marks_merged_layers(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	wt := WorkTree(t, repo)
+	CheckoutBranch(t, wt, "master")
+
+	_, err := GitCmd(t, "merge", "--no-ff", "-m", "Merge kb1234/002_api", "kb1234/002_api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	CheckoutBranch(t, wt, "kb1234/003_ui")
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "status"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, string(buf.Bytes())).Equals(`In stack kb1234
+On branch kb1234/003_ui
+
+Local Stack:
+    001_docs a4f8278 Add README.md 🚢
+    002_api  e8decd8 Add api.js 🚢
+  * 003_ui   cd73600 Add ui.js
+`)
+}
+
+func Test_status_does_not_mark_empty_first_layer_merged(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	InitialCommit(t, repo)
+	i := Exec(Flags{SubCommand: "init", Name: "kb1234/docs"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	wt := WorkTree(t, repo)
+	CheckoutBranch(t, wt, "master")
+	Commit(t, wt, map[string]string{"main.go": "package main"}, "Add main.go")
+	CheckoutBranch(t, wt, "kb1234/001_docs")
+
+	var buf bytes.Buffer
+	i = Exec(Flags{SubCommand: "status", Porcelain: true}, &buf)
+	assert.Int(t, i).Equals(Success)
+	if !strings.Contains(buf.String(), " none - - 0 001_docs\n") {
+		t.Errorf("want 001_docs unmerged, got `%s`", buf.String())
+	}
+}
+
+func Test_status_counts_commits_ahead_and_behind_remote(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo1, r1close := CreateRepo(t)
+	defer r1close()
+
+	wt1 := WorkTree(t, repo1)
+	CreateThreeLayerStack(t, repo1)
+	CreateRemote(t, repo1, server)
+	PushBranch(t, repo1, "kb1234/001_docs")
+	PushBranch(t, repo1, "kb1234/002_api")
+	PushBranch(t, repo1, "kb1234/003_ui")
+
+	repo2, r2close := CloneRepo(t, server, "kb1234/003_ui")
+	defer r2close()
+	FetchRefs(t, repo2, "kb1234/*")
+	wt2 := WorkTree(t, repo2)
+	Commit(t, wt2, map[string]string{"ui.js": "function ui() { return false; }"}, "Update ui.js")
+
+	Chdir(t, wt1)
+	Commit(t, wt1, map[string]string{"ui.js": "function ui() { return true; }"}, "Update ui.js")
+	Commit(t, wt1, map[string]string{"ui.css": "body {}"}, "Add ui.css")
+	PushBranch(t, repo1, "kb1234/003_ui")
+	CheckoutBranch(t, wt1, "kb1234/002_api")
+	Commit(t, wt1, map[string]string{"api.js": "function api() { return true; }"}, "Update api.js")
+	PushBranch(t, repo1, "kb1234/002_api")
+
+	Chdir(t, wt2)
+	_, err := GitCmd(t, "fetch", "origin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "status"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, string(buf.Bytes())).Equals(`In stack kb1234
+On branch kb1234/003_ui
+Remote origin
+
+Local Stack (+ ahead, - behind, = same, ∇ diverged):
+    (=) 001_docs a4f8278 Add README.md
+    (-) 002_api  e8decd8 Add api.js [ahead 0, behind 1]
+  * (∇) 003_ui   65b18a7 Update ui.js [ahead 1, behind 2]
+`)
+}
+
+func Test_status_uses_remote_tracking_refs_when_offline(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+
+	PushBranch(t, repo, "kb1234/001_docs")
+	PushBranch(t, repo, "kb1234/002_api")
+	srvclose()
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "status"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, string(buf.Bytes())).Equals(`In stack kb1234
+On branch kb1234/003_ui
+Remote origin
+
+Local Stack (+ ahead, - behind, = same, ∇ diverged):
+    (=) 001_docs a4f8278 Add README.md
+    (=) 002_api  e8decd8 Add api.js
+  * (+) 003_ui   cd73600 Add ui.js
+`)
+
+	i = Exec(Flags{SubCommand: "status", Fetch: true}, io.Discard)
+	assert.Int(t, i).Equals(ErrOutputWriter)
+}
+
+func Test_status_json_on_branch(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	InitialCommit(t, repo)
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "status", JSON: true}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`{
+  "version": 1,
+  "stack": "",
+  "branch": "master",
+  "current": "",
+  "layers": []
+}
+`)
+}
+
+func Test_status_json_with_default_remote(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+
+	PushBranch(t, repo, "kb1234/001_docs")
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "status", JSON: true}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`{
+  "version": 1,
+  "stack": "kb1234",
+  "branch": "kb1234/003_ui",
+  "current": "003_ui",
+  "remote": "origin",
+  "layers": [
+    {
+      "name": "001_docs",
+      "branch": "kb1234/001_docs",
+      "sequence": 1,
+      "sha": "a4f827873e47c34ce19606a443d006bf4ad91c7b",
+      "subject": "Add README.md",
+      "current": false,
+      "merged": false,
+      "remote": {
+        "state": "same",
+        "ahead": 0,
+        "behind": 0
+      }
+    },
+    {
+      "name": "002_api",
+      "branch": "kb1234/002_api",
+      "sequence": 2,
+      "sha": "e8decd873cdc5bbae596728454843ba9981bd8d3",
+      "subject": "Add api.js",
+      "current": false,
+      "merged": false,
+      "remote": {
+        "state": "unpushed"
+      }
+    },
+    {
+      "name": "003_ui",
+      "branch": "kb1234/003_ui",
+      "sequence": 3,
+      "sha": "cd736002a73710b4e8c732beb50021737a5925f0",
+      "subject": "Add ui.js",
+      "current": true,
+      "merged": false,
+      "remote": {
+        "state": "unpushed"
+      }
+    }
+  ]
+}
+`)
+}
+
+func Test_status_porcelain_with_default_remote(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+
+	PushBranch(t, repo, "kb1234/001_docs")
+	PushBranch(t, repo, "kb1234/002_api")
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "status", Porcelain: true}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`# version 1
+# stack kb1234
+# branch kb1234/003_ui
+# remote origin
+layer 001 . a4f827873e47c34ce19606a443d006bf4ad91c7b same 0 0 0 001_docs
+layer 002 . e8decd873cdc5bbae596728454843ba9981bd8d3 same 0 0 0 002_api
+layer 003 * cd736002a73710b4e8c732beb50021737a5925f0 unpushed - - 0 003_ui
+`)
+}
+
+func Test_status_json_reports_pull_request_state(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+	PushBranch(t, repo, "kb1234/001_docs")
+
+	FakePullRequests(t,
+		PullRequest{Head: "kb1234/001_docs", State: "closed", URL: "https://github.com/nfisher/gitit/pull/1"},
+		PullRequest{Head: "kb1234/002_api", State: "open", URL: "https://github.com/nfisher/gitit/pull/2"},
+		PullRequest{Head: "kb1234/003_ui", State: "open", Failing: true, URL: "https://github.com/nfisher/gitit/pull/3"})
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "status", Fetch: true, JSON: true}, &buf)
+	assert.Int(t, i).Equals(Success)
+
+	var v struct {
+		Layers []struct {
+			PullRequest struct{ State string } `json:"pull_request"`
+		}
+	}
+	err := json.Unmarshal(buf.Bytes(), &v)
+	if err != nil {
+		t.Fatalf("call=Unmarshal err=`%v`\n", err)
+	}
+	var states []string
+	for _, l := range v.Layers {
+		states = append(states, l.PullRequest.State)
+	}
+	assert.String(t, strings.Join(states, " ")).Equals("closed open failing")
+}
+
+func Test_status_fetch_prunes_deleted_remote_branches(t *testing.T) {
+	server, srvclose := LaunchServer(t)
+	defer srvclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, server)
+	t.Setenv("GITHUB_TOKEN", "")
+
+	i := Exec(Flags{SubCommand: "push"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	err := server.Repo.Storer.RemoveReference(plumbing.NewBranchReferenceName("kb1234/003_ui"))
+	if err != nil {
+		t.Fatalf("call=RemoveReference err=`%v`\n", err)
+	}
+
+	i = Exec(Flags{SubCommand: "status", Fetch: true}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+
+	repo = Reopen(t, repo)
+	_, err = repo.Reference(plumbing.NewRemoteReferenceName("origin", "kb1234/003_ui"), true)
+	if err != plumbing.ErrReferenceNotFound {
+		t.Errorf("want pruned origin/kb1234/003_ui, got err=`%v`", err)
+	}
+	_, err = repo.Reference(plumbing.NewRemoteReferenceName("origin", "kb1234/002_api"), true)
+	if err != nil {
+		t.Errorf("want origin/kb1234/002_api, got err=`%v`", err)
+	}
+}
+
+func Test_status_json_and_porcelain_are_exclusive(t *testing.T) {
+	i := Exec(Flags{SubCommand: "status", JSON: true, Porcelain: true}, io.Discard)
+	assert.Int(t, i).Equals(ErrInvalidArgument)
+}
+
+func Test_status_shows_recorded_base(t *testing.T) {
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+	InitialCommit(t, repo)
+
+	i := Exec(Flags{SubCommand: "init", Name: "kb1234/docs"}, io.Discard)
+	assert.Int(t, i).Equals(Success)
+	Commit(t, WorkTree(t, repo), map[string]string{"README.md": "Hello world"}, "Add README.md")
+
+	var buf bytes.Buffer
+	i = Exec(Flags{SubCommand: "status"}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`In stack kb1234
+On branch kb1234/001_docs
+Based on master
+
+Local Stack:
+  * 001_docs ddb5a79 Add README.md
+`)
+}
+
+func Test_status_fetch_from_empty_remote_reports_unpushed_layers(t *testing.T) {
+	origin, originclose := LaunchServer(t)
+	defer originclose()
+
+	fork, forkclose := LaunchServer(t)
+	defer forkclose()
+
+	repo, repoclose := CreateRepo(t)
+	defer repoclose()
+
+	CreateThreeLayerStack(t, repo)
+	CreateRemote(t, repo, origin)
+	CreateNamedRemote(t, repo, "fork", fork)
+
+	var buf bytes.Buffer
+	i := Exec(Flags{SubCommand: "status", Fetch: true, Remote: "fork", Porcelain: true}, &buf)
+	assert.Int(t, i).Equals(Success)
+	assert.String(t, buf.String()).Equals(`# version 1
+# stack kb1234
+# branch kb1234/003_ui
+# remote fork
+layer 001 . a4f827873e47c34ce19606a443d006bf4ad91c7b unpushed - - 0 001_docs
+layer 002 . e8decd873cdc5bbae596728454843ba9981bd8d3 unpushed - - 0 002_api
+layer 003 * cd736002a73710b4e8c732beb50021737a5925f0 unpushed - - 0 003_ui
 `)
 }
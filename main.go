@@ -6,17 +6,7 @@ import (
 )
 
 func main() {
-	var input cmd.Flags
-
-	if len(os.Args) > 1 {
-		input.SubCommand = os.Args[1]
-	}
-
-	if len(os.Args) > 2 {
-		input.Name = os.Args[2]
-	}
-
-	os.Exit(cmd.Exec(input, os.Stdout))
+	os.Exit(cmd.Main(os.Args[1:], os.Stdout, os.Stderr))
 }
 
 var example = `In stack %s